@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +26,9 @@ func setupRouter() (r *gin.Engine) {
 
 	r.GET("/ping", handlePing)
 	r.GET("/sub", handleSubscription)
+	r.GET("/ruleset/:hash", handleRuleset)
+	r.GET("/provider", handleProvider)
+	r.GET("/geosite", handleGeosite)
 	r.GET("/ui", handleUI)
 	r.GET("/s/:code", handleShortUrl)
 	r.POST("/s/create", handleCreateShortUrl)
@@ -87,6 +92,13 @@ func handleSubscription(c *gin.Context) {
 	subs := c.QueryArray("sub")
 	scriptUrl := c.Query("script")
 	templateUrl := c.Query("template")
+	target := c.Query("target")
+	core := c.Query("core")
+	rulesetMode := c.Query("ruleset_mode")
+	rulesetFormat := c.Query("ruleset_format")
+	proxyMode := c.Query("proxy_mode")
+	geoMode := c.Query("geo_mode")
+	targetTemplateUrl := c.Query("target_template")
 	userToken := c.Query("token")
 
 	// 鉴权
@@ -102,47 +114,160 @@ func handleSubscription(c *gin.Context) {
 		return
 	}
 
+	// 输出目标，默认为 Clash
+	var renderer *ConfigRenderer
+	if target != "" && target != "clash" {
+		var ok bool
+		renderer, ok = ConfigRenderers[target]
+		if !ok {
+			c.String(http.StatusBadRequest, fmt.Sprintf("unsupported target: %s", target))
+			return
+		}
+	}
+
+	// 目标内核，仅对 Clash 输出生效
+	var profile *CoreProfile
+	if core != "" {
+		var ok bool
+		profile, ok = CoreProfiles[core]
+		if !ok {
+			c.String(http.StatusBadRequest, fmt.Sprintf("unsupported core: %s", core))
+			return
+		}
+		if renderer != nil {
+			c.String(http.StatusBadRequest, "core only applies to clash target")
+			return
+		}
+	}
+
+	// 规则集输出方式：inline（默认）内联规则，provider 生成 rule-providers
+	rulesetBaseUrl := ""
+	switch rulesetMode {
+	case "", "inline":
+	case "provider":
+		if renderer != nil {
+			c.String(http.StatusBadRequest, "ruleset_mode=provider only applies to clash target")
+			return
+		}
+		if profile != nil && !profile.RuleTypes.Has("RULE-SET") {
+			c.String(http.StatusBadRequest, fmt.Sprintf("core %s does not support rule-providers", core))
+			return
+		}
+		rulesetBaseUrl = requestBaseUrl(c)
+	default:
+		c.String(http.StatusBadRequest, fmt.Sprintf("unsupported ruleset_mode: %s", rulesetMode))
+		return
+	}
+
+	// 规则集格式：yaml（默认），mrs 时声明了 domain / ipcidr 行为的规则集以 .mrs 输出，仅 mihomo 支持
+	switch rulesetFormat {
+	case "", "yaml":
+	case "mrs":
+		if rulesetBaseUrl == "" {
+			c.String(http.StatusBadRequest, "ruleset_format=mrs requires ruleset_mode=provider")
+			return
+		}
+		if profile != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("core %s does not support mrs rulesets", core))
+			return
+		}
+	default:
+		c.String(http.StatusBadRequest, fmt.Sprintf("unsupported ruleset_format: %s", rulesetFormat))
+		return
+	}
+
+	// GEOSITE / GEOIP 规则处理方式：keep（默认）保持原样，expand 使用数据目录中的 geodata 展开为具体规则
+	switch geoMode {
+	case "", "keep":
+	case "expand":
+		// /ruleset/:hash 输出的规则集不会被展开，客户端缺少 geodata 时其中的 GEOSITE / GEOIP 规则无法生效
+		if rulesetBaseUrl != "" {
+			c.String(http.StatusBadRequest, "geo_mode=expand does not support ruleset_mode=provider")
+			return
+		}
+	default:
+		c.String(http.StatusBadRequest, fmt.Sprintf("unsupported geo_mode: %s", geoMode))
+		return
+	}
+
+	// 节点输出方式：inline（默认）内联节点，provider 生成引用 /provider 的 proxy-providers
+	useProxyProviders := false
+	switch proxyMode {
+	case "", "inline":
+	case "provider":
+		if renderer != nil {
+			c.String(http.StatusBadRequest, "proxy_mode=provider only applies to clash target")
+			return
+		}
+		if profile != nil && slices.Contains(profile.GroupFields, "filter") {
+			c.String(http.StatusBadRequest, fmt.Sprintf("core %s does not support group filter required by proxy_mode=provider", core))
+			return
+		}
+		useProxyProviders = true
+	default:
+		c.String(http.StatusBadRequest, fmt.Sprintf("unsupported proxy_mode: %s", proxyMode))
+		return
+	}
+
+	// 仅输出节点的目标不需要模板和脚本
+	proxiesOnly := renderer != nil && renderer.ProxiesOnly
+
 	// 如果未提供 script 或 template，使用默认文件
-	if scriptUrl == "" {
-		defaultScriptPath := "./config/script.js"
-		if !FileExists(defaultScriptPath) {
+	if scriptUrl == "" && !proxiesOnly {
+		var ok bool
+		scriptUrl, ok = defaultConfigUrl(c, "script.js")
+		if !ok {
 			c.String(http.StatusNotFound, "Default script file not found")
 			return
 		}
-		scheme := "http"
-		if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
-			scheme = "https"
-		}
-		scriptUrl = scheme + "://" + c.Request.Host + "/config/script.js"
 	}
-	if templateUrl == "" {
-		defaultTemplatePath := "./config/template.yaml"
-		if !FileExists(defaultTemplatePath) {
+	if templateUrl == "" && !proxiesOnly {
+		var ok bool
+		templateUrl, ok = defaultConfigUrl(c, "template.yaml")
+		if !ok {
 			c.String(http.StatusNotFound, "Default template file not found")
 			return
 		}
-		scheme := "http"
-		if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
-			scheme = "https"
+	}
+	if renderer != nil && targetTemplateUrl == "" && renderer.DefaultTemplate != "" {
+		var ok bool
+		targetTemplateUrl, ok = defaultConfigUrl(c, renderer.DefaultTemplate)
+		if !ok {
+			c.String(http.StatusNotFound, "Default target template file not found")
+			return
 		}
-		templateUrl = scheme + "://" + c.Request.Host + "/config/template.yaml"
 	}
 
 	// 提取所有订阅的节点
-	allProxies := make([]SubscriptionData, 0, len(subs))
-	for i, sub := range subs {
-		name := fmt.Sprintf("订阅%02d", i+1)
-		proxies, err := ExtractProxies(sub, name)
+	allProxies, err := extractSubscriptions(subs)
+	if err != nil {
+		L().Error(err.Error())
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 合并订阅数据
+	mergedProxies := mergeProxies(allProxies)
+
+	if proxiesOnly {
+		proxies := make([]any, 0, len(mergedProxies.Proxies))
+		for _, proxy := range mergedProxies.Proxies {
+			proxies = append(proxies, proxy)
+		}
+
+		rendered, err := renderer.Render(map[string]any{"proxies": proxies}, "")
 		if err != nil {
 			L().Error(err.Error())
-			c.String(http.StatusInternalServerError, fmt.Sprintf("%s:\n%s", sub, err.Error()))
+			c.String(http.StatusInternalServerError, err.Error())
 			return
 		}
-		allProxies = append(allProxies, proxies)
-	}
 
-	// 合并订阅数据
-	mergedProxies := mergeProxies(allProxies)
+		for h, v := range mergedProxies.TransparentHeaders {
+			c.Header(h, v)
+		}
+		writeRendered(c, target, renderer, rendered)
+		return
+	}
 
 	// 获取模板和脚本
 	template, err := FetchString(templateUrl)
@@ -160,13 +285,23 @@ func handleSubscription(c *gin.Context) {
 	}
 
 	// 执行 JS 脚本生成配置
-	result, err := ExecJs(script, template, mergedProxies)
+	result, err := ExecJs(script, template, mergedProxies, rulesetBaseUrl, rulesetFormat)
 	if err != nil {
 		L().Error(err.Error())
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	// 展开 GEOSITE / GEOIP 规则
+	if geoMode == "expand" {
+		result, err = expandGeoRules(result)
+		if err != nil {
+			L().Error(err.Error())
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	// 添加用量信息节点组
 	finalResult, err := addSubInfoGroup(result, mergedProxies.SubInfos)
 	if err != nil {
@@ -175,9 +310,196 @@ func handleSubscription(c *gin.Context) {
 		return
 	}
 
+	// 订阅节点改为通过 proxy-providers 引用
+	if useProxyProviders {
+		providers := newSubscriptionProviders(subs, allProxies, requestBaseUrl(c))
+		finalResult, err = applyProxyProviders(finalResult, providers)
+		if err != nil {
+			L().Error(err.Error())
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	// 设置响应头
 	for h, v := range mergedProxies.TransparentHeaders {
 		c.Header(h, v)
 	}
-	c.String(http.StatusOK, finalResult)
+
+	if renderer == nil {
+		if profile != nil {
+			var dropped []DroppedItem
+			finalResult, dropped, err = applyCoreProfile(finalResult, profile)
+			if err != nil {
+				L().Error(err.Error())
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeDropped(c, "core "+core, dropped)
+		}
+		c.String(http.StatusOK, finalResult)
+		return
+	}
+
+	// 渲染为目标客户端格式
+	rendered, err := renderTarget(renderer, finalResult, targetTemplateUrl)
+	if err != nil {
+		L().Error(err.Error())
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeRendered(c, target, renderer, rendered)
+}
+
+// extractSubscriptions 依次提取每个订阅的节点，错误信息中包含出错的订阅地址
+func extractSubscriptions(subs []string) (allProxies []SubscriptionData, err error) {
+	allProxies = make([]SubscriptionData, 0, len(subs))
+	for i, sub := range subs {
+		name := fmt.Sprintf("订阅%02d", i+1)
+		var proxies SubscriptionData
+		proxies, err = ExtractProxies(sub, name)
+		if err != nil {
+			err = fmt.Errorf("%s:\n%s", sub, err.Error())
+			return
+		}
+		allProxies = append(allProxies, proxies)
+	}
+	return
+}
+
+// writeRendered 记录被丢弃的内容并输出渲染结果
+func writeRendered(c *gin.Context, target string, renderer *ConfigRenderer, rendered RenderResult) {
+	writeDropped(c, "target "+target, rendered.Dropped)
+	c.Data(http.StatusOK, renderer.ContentType, []byte(rendered.Body))
+}
+
+// writeDropped 记录被丢弃的内容并设置计数响应头
+func writeDropped(c *gin.Context, reason string, dropped []DroppedItem) {
+	result := RenderResult{Dropped: dropped}
+	for _, item := range dropped {
+		L().Warn(fmt.Sprintf("Dropped for %s: %s", reason, item.String()))
+	}
+	c.Header("X-Dropped-Count", strconv.Itoa(len(dropped)))
+	c.Header("X-Dropped-Rule-Count", strconv.Itoa(result.DroppedCount("rule")))
+}
+
+// handleRuleset 返回 rule-providers 引用的规则集，内容经过整理且不含 tag
+func handleRuleset(c *gin.Context) {
+	ruleset, err := FindRuleset(c.Param("hash"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.String(http.StatusNotFound, "Ruleset not found")
+			return
+		}
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	format := c.Query("format")
+	if !RulesetFormats.Has(format) {
+		c.String(http.StatusBadRequest, fmt.Sprintf("unsupported ruleset format: %s", format))
+		return
+	}
+
+	content, err := RenderRuleset(ruleset, format)
+	if err != nil {
+		L().Error(err.Error())
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if format == "mrs" {
+		c.Data(http.StatusOK, "application/octet-stream", content)
+		return
+	}
+	c.Data(http.StatusOK, "text/yaml; charset=utf-8", content)
+}
+
+// handleGeosite 列出数据目录中 geosite.dat 的分类，指定 category 时输出该分类展开后的规则
+func handleGeosite(c *gin.Context) {
+	category := c.Query("category")
+	if category != "" {
+		content, err := RenderGeosite(category)
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		c.String(http.StatusOK, content)
+		return
+	}
+
+	categories, err := ListGeosite()
+	if err != nil {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// handleProvider 以 proxies 文档输出订阅节点，供 proxy-providers 引用
+// 多个订阅会被合并，支持 filter / exclude_filter / exclude_type 过滤节点
+func handleProvider(c *gin.Context) {
+	subs := c.QueryArray("sub")
+	userToken := c.Query("token")
+
+	// 鉴权
+	if userToken != Token {
+		L().Warn("Unauthorized request received")
+		c.String(http.StatusUnauthorized, "Unauthorized request")
+		return
+	}
+
+	if len(subs) == 0 {
+		c.String(http.StatusBadRequest, "sub is required")
+		return
+	}
+
+	allProxies, err := extractSubscriptions(subs)
+	if err != nil {
+		L().Error(err.Error())
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	mergedProxies := mergeProxies(allProxies)
+
+	proxies, err := filterProviderProxies(mergedProxies.Proxies, ProxyProvider{
+		Filter:        c.Query("filter"),
+		ExcludeFilter: c.Query("exclude_filter"),
+		ExcludeType:   c.Query("exclude_type"),
+	})
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	content, err := Marshal(map[string]any{"proxies": proxies})
+	if err != nil {
+		L().Error(err.Error())
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 透传流量信息，客户端可据此显示 provider 的用量
+	for h, v := range mergedProxies.TransparentHeaders {
+		c.Header(h, v)
+	}
+	c.Data(http.StatusOK, "text/yaml; charset=utf-8", []byte(content))
+}
+
+// requestBaseUrl 返回当前请求的 scheme://host
+func requestBaseUrl(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// defaultConfigUrl 返回 config 目录下默认文件的访问地址，文件不存在时 ok=false
+func defaultConfigUrl(c *gin.Context, file string) (url string, ok bool) {
+	if !FileExists("./config/" + file) {
+		return
+	}
+	return requestBaseUrl(c) + "/config/" + file, true
 }
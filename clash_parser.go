@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlclark/regexp2"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxProviderDepth proxy-providers 嵌套解析的最大深度，防止循环引用
+const MaxProviderDepth = 3
+
+// providerRegexTimeout 单次正则匹配的超时时间，filter 等正则来自上游配置或请求参数，防止回溯过多的正则阻塞请求
+const providerRegexTimeout = 100 * time.Millisecond
+
+// ProxyProvider Clash proxy-providers 中的单个提供者
+type ProxyProvider struct {
+	Type          string           `yaml:"type"`
+	Url           string           `yaml:"url"`
+	Filter        string           `yaml:"filter"`
+	ExcludeFilter string           `yaml:"exclude-filter"`
+	ExcludeType   string           `yaml:"exclude-type"`
+	Override      map[string]any   `yaml:"override"`
+	Payload       []map[string]any `yaml:"payload"`
+}
+
+// isClashConfig 判断内容是否为包含 proxies 或 proxy-providers 的 Clash 配置
+func isClashConfig(body string) bool {
+	var config map[string]any
+	if err := yaml.Unmarshal([]byte(body), &config); err != nil {
+		return false
+	}
+	_, hasProxies := config["proxies"]
+	_, hasProviders := config["proxy-providers"]
+	return hasProxies || hasProviders
+}
+
+// parseClashConfig 解析 Clash 配置中的 proxies，并将 proxy-providers 展开为具体节点
+func parseClashConfig(body string) ([]map[string]any, error) {
+	return parseClashConfigWithDepth(body, 0)
+}
+
+func parseClashConfigWithDepth(body string, depth int) (proxies []map[string]any, err error) {
+	var config struct {
+		Proxies        []map[string]any `yaml:"proxies"`
+		ProxyProviders yaml.Node        `yaml:"proxy-providers"`
+	}
+	err = yaml.Unmarshal([]byte(body), &config)
+	if err != nil {
+		return
+	}
+
+	proxies = config.Proxies
+	if config.ProxyProviders.Kind != yaml.MappingNode {
+		return
+	}
+
+	names := NewSet()
+	for _, proxy := range proxies {
+		names[fmt.Sprintf("%v", proxy["name"])] = true
+	}
+
+	// 使用 yaml.Node 遍历以保持 proxy-providers 的书写顺序
+	content := config.ProxyProviders.Content
+	for i := 0; i+1 < len(content); i += 2 {
+		providerName := content[i].Value
+
+		var provider ProxyProvider
+		err = content[i+1].Decode(&provider)
+		if err != nil {
+			err = fmt.Errorf("proxy-provider %s: %s", providerName, err.Error())
+			return
+		}
+
+		var providerProxies []map[string]any
+		providerProxies, err = resolveProxyProvider(providerName, provider, depth)
+		if err != nil {
+			err = fmt.Errorf("proxy-provider %s: %s", providerName, err.Error())
+			return
+		}
+
+		for _, proxy := range providerProxies {
+			proxy["name"] = uniqueName(names, fmt.Sprintf("%v", proxy["name"]))
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	return
+}
+
+// resolveProxyProvider 获取单个 provider 的节点并应用 filter / exclude-filter / exclude-type / override
+func resolveProxyProvider(name string, provider ProxyProvider, depth int) (proxies []map[string]any, err error) {
+	switch provider.Type {
+	case "inline":
+		proxies = provider.Payload
+	case "http":
+		if depth >= MaxProviderDepth {
+			err = fmt.Errorf("nested too deep")
+			return
+		}
+		// provider 地址来自上游配置，只允许 http(s)，file: / data: 仅用于用户自己的 sub 参数
+		if !isRemoteUrl(provider.Url) {
+			L().Warn(fmt.Sprintf("Skip proxy-provider %s: unsupported url %s", name, subscriptionLogUrl(provider.Url)))
+			return
+		}
+
+		var content string
+		content, err = GetOrPut(provider.Url, fetchProviderContent)
+		if err != nil {
+			return
+		}
+
+		var parser SubscriptionParser
+		parser, err = selectParser("", "", content)
+		if err != nil {
+			return
+		}
+
+		L().Info(fmt.Sprintf("Parsing proxy-provider %s with parser: %s", name, parser.Name()))
+		if parser.Name() == "clash" {
+			proxies, err = parseClashConfigWithDepth(content, depth+1)
+		} else {
+			proxies, err = parser.Parse(content, &SubscriptionMeta{Url: provider.Url, Name: name})
+		}
+		if err != nil {
+			return
+		}
+	default:
+		L().Warn(fmt.Sprintf("Skip proxy-provider %s: unsupported type %s", name, provider.Type))
+		return
+	}
+
+	proxies, err = filterProviderProxies(proxies, provider)
+	if err != nil {
+		return
+	}
+
+	for _, proxy := range proxies {
+		applyProviderOverride(proxy, provider.Override)
+	}
+
+	return
+}
+
+// fetchProviderContent 以 Clash UA 获取 provider 内容
+func fetchProviderContent(url string) (string, error) {
+	L().Info(fmt.Sprintf("Fetching %s", url))
+
+	res, err := fetchRemoteSubscription(url)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("%d\n%s", res.StatusCode, res.Body)
+	}
+	return res.Body, nil
+}
+
+// compileFilters 编译以 ` 分隔的多个正则，与 mihomo 一致使用 regexp2 语法（支持 (?!...) 等）
+func compileFilters(filter string) (patterns []*regexp2.Regexp, err error) {
+	for _, expr := range strings.Split(filter, "`") {
+		if expr == "" {
+			continue
+		}
+		var pattern *regexp2.Regexp
+		pattern, err = regexp2.Compile(expr, regexp2.None)
+		if err != nil {
+			return
+		}
+		pattern.MatchTimeout = providerRegexTimeout
+		patterns = append(patterns, pattern)
+	}
+	return
+}
+
+// matchAny 判断名称是否匹配任一正则，匹配超时视为不匹配
+func matchAny(patterns []*regexp2.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		matched, err := pattern.MatchString(name)
+		if err != nil {
+			L().Warn(fmt.Sprintf("Filter %s: %s", pattern.String(), err.Error()))
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// filterProviderProxies 按 provider 的 filter / exclude-filter / exclude-type 过滤节点
+func filterProviderProxies(proxies []map[string]any, provider ProxyProvider) (result []map[string]any, err error) {
+	filters, err := compileFilters(provider.Filter)
+	if err != nil {
+		return
+	}
+	excludeFilters, err := compileFilters(provider.ExcludeFilter)
+	if err != nil {
+		return
+	}
+
+	excludeTypes := NewSet()
+	for _, t := range strings.Split(provider.ExcludeType, "|") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			excludeTypes[t] = true
+		}
+	}
+
+	result = make([]map[string]any, 0, len(proxies))
+	for _, proxy := range proxies {
+		name := fmt.Sprintf("%v", proxy["name"])
+		if len(filters) > 0 && !matchAny(filters, name) {
+			continue
+		}
+		if matchAny(excludeFilters, name) {
+			continue
+		}
+		if excludeTypes.Has(strings.ToLower(fmt.Sprintf("%v", proxy["type"]))) {
+			continue
+		}
+		result = append(result, proxy)
+	}
+
+	return
+}
+
+// applyProviderOverride 应用 provider 的 override 设置
+// proxy-name 正则替换、additional-prefix / additional-suffix 作用于名称，其余字段直接覆盖
+func applyProviderOverride(proxy map[string]any, override map[string]any) {
+	name := fmt.Sprintf("%v", proxy["name"])
+
+	for key, value := range override {
+		switch key {
+		case "proxy-name":
+			rules, _ := value.([]any)
+			for _, rule := range rules {
+				r, _ := rule.(map[string]any)
+				pattern, err := regexp2.Compile(anyToString(r["pattern"]), regexp2.None)
+				if err != nil {
+					L().Warn(fmt.Sprintf("Invalid proxy-name pattern: %s", err.Error()))
+					continue
+				}
+				pattern.MatchTimeout = providerRegexTimeout
+				replaced, err := pattern.Replace(name, anyToString(r["target"]), -1, -1)
+				if err != nil {
+					L().Warn(fmt.Sprintf("Proxy-name pattern %s: %s", pattern.String(), err.Error()))
+					continue
+				}
+				name = replaced
+			}
+		case "additional-prefix", "additional-suffix":
+		default:
+			proxy[key] = value
+		}
+	}
+
+	if prefix, ok := override["additional-prefix"].(string); ok {
+		name = prefix + name
+	}
+	if suffix, ok := override["additional-suffix"].(string); ok {
+		name = name + suffix
+	}
+	proxy["name"] = name
+}
@@ -175,6 +175,8 @@ DIALERS.forEach(d => d['dialer-proxy'] = DIALER_PROXY_GROUP_NAME)
 // impl
 // rulesets 函数：注册一组远程规则集（按名称 + URL）
 // 参数 r 是一个“注册器”函数，调用 r(name, url) 会把远程规则加入到最终配置中
+// 纯域名或 CIDR 列表可以通过第三个参数声明行为：r(name, url, 'domain') / r(name, url, 'ipcidr')
+// 第三个参数也可以是选项对象，例如 r(name, url, { format: 'yaml', noResolve: true, ttl: 3600, optional: true })
 function rulesets(r) {
     //本地局域网
     r("DIRECT", "https://raw.githubusercontent.com/ACL4SSR/ACL4SSR/master/Clash/LocalAreaNetwork.list")
@@ -199,8 +201,10 @@ function rulesets(r) {
     r("OpenAI", "https://raw.githubusercontent.com/ACL4SSR/ACL4SSR/master/Clash/Ruleset/OpenAi.list")
     //Google
     r("Google", "https://raw.githubusercontent.com/ACL4SSR/ACL4SSR/master/Clash/Ruleset/Google.list")
-    // r("Gemini", "https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/Gemini/Gemini.yaml")
-    // r("BardAI","https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/BardAI/BardAI.yaml")    
+    //Gemini（BardAI 为其旧名称，同样走 Gemini 代理组），blackmatrix7 的 YAML 规则集（payload:）
+    r("Gemini", "https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/Gemini/Gemini.yaml")
+    r("Gemini", "https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/BardAI/BardAI.yaml")
+    // 其它 blackmatrix7 规则集启用前需先添加同名的代理组
     // r("Chromecast","https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/Chromecast/Chromecast.yaml") 
     // r("YouTubeMusic","https://raw.githubusercontent.com/blackmatrix7/ios_rule_script/master/rule/Clash/YouTubeMusic/YouTubeMusic.yaml") 
 
@@ -303,7 +307,7 @@ function buildGroups(proxy_names) {
 
     groups.push(SEL_GROUP('PROXY',  [ 'DIRECT', ...PROXIES ]))
     // Gemini 代理组：使用正则表达式自动过滤日本或美国节点
-    // groups.push(SEL_GROUP('Gemini', [ ...gemini_nodes, 'DIRECT' ]))
+    groups.push(SEL_GROUP('Gemini', [ ...gemini_nodes, 'DIRECT' ]))
     groups.push(SEL_GROUP('OpenAI', NORMAL))
     // 自定义规则集的代理组
     groups.push(...my_rule_groups)
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/netip"
+	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -55,9 +58,10 @@ var ClashHeaders = NewSet(
 )
 
 // BuildTemplate 根据模板、节点和规则构建最终配置
-// 规则重写逻辑：为每条规则添加 tag，支持3段和2段规则格式
+// 规则重写逻辑：解析规则集中的每条规则，以 tag 作为 target 重新序列化，附加参数保留在 target 之后
+// rulesetBaseUrl 不为空时，每个规则集生成一个指向 /ruleset/:hash 的 rule-providers 条目，而不是内联规则
 func BuildTemplate(
-	template string, Proxies SubscriptionData, ruleLines []*Ruleset,
+	template string, Proxies SubscriptionData, ruleLines []*Ruleset, rulesetBaseUrl string, rulesetFormat string,
 ) (result map[string]any, err error) {
 	err = yaml.Unmarshal([]byte(template), &result)
 	if err != nil {
@@ -67,35 +71,47 @@ func BuildTemplate(
 	result["proxies"] = Proxies.Proxies
 	rules := make([]string, 0, 4096)
 
-	for _, rule := range ruleLines {
-		tag := rule.tag
-		for _, r := range strings.Split(rule.content, "\n") {
-			r = strings.TrimSpace(r)
-			if len(r) == 0 || r[0] == '#' {
-				continue
-			}
-
-			ruleComponents := strings.Split(r, ",")
-			if len(ruleComponents) < 2 {
-				err = fmt.Errorf("rules must have at least 2 componets: %s", rule.content)
-				return
-			}
-
-			if !RuleTypes.Has(ruleComponents[0]) {
-				continue
-			}
-
-			// 3段规则：TYPE,VALUE,OPTIONS -> TYPE,VALUE,TAG,OPTIONS
-			if len(ruleComponents) == 3 {
-				rules = append(rules, fmt.Sprintf(
-					"%s,%s,%s,%s",
-					ruleComponents[0], ruleComponents[1], tag, ruleComponents[2],
-				))
-			} else {
-				// 2段规则：TYPE,VALUE -> TYPE,VALUE,TAG
-				rules = append(rules, r+","+tag)
-			}
+	if rulesetBaseUrl != "" {
+		var providers map[string]any
+		providers, rules, err = buildRuleProviders(ruleLines, rulesetBaseUrl, rulesetFormat)
+		if err != nil {
+			return
 		}
+		result["rule-providers"] = providers
+		result["rules"] = rules
+		return
+	}
+
+	parsed := make([]*Rule, 0, 4096)
+	for _, ruleset := range ruleLines {
+		if ruleset.skipped {
+			continue
+		}
+		normalized, dropped, e := ruleset.normalize(true)
+		if e != nil && ruleset.options.Optional {
+			L().Warn(fmt.Sprintf("Skipped optional ruleset %s: %s", ruleset.url, e.Error()))
+			continue
+		}
+		if e != nil {
+			err = fmt.Errorf("ruleset %s: %w", ruleset.url, e)
+			return
+		}
+		logDroppedRules(ruleset.url, dropped)
+
+		for _, r := range normalized {
+			r.Target = ruleset.tag
+			parsed = append(parsed, r)
+		}
+	}
+
+	// 去重并移除永远不会命中的规则
+	optimized, stats := optimizeRules(parsed)
+	L().Info(fmt.Sprintf(
+		"Optimized rules: %d -> %d (duplicate %d, shadowed %d, merged %d)",
+		len(parsed), len(optimized), stats.Duplicate, stats.Shadowed, stats.Merged,
+	))
+	for _, r := range optimized {
+		rules = append(rules, r.String())
 	}
 
 	result["rules"] = rules
@@ -103,6 +119,192 @@ func BuildTemplate(
 	return
 }
 
+// rulesetLine 规则集中的一个条目及其行号
+type rulesetLine struct {
+	number int
+	text   string
+}
+
+// normalizeRuleset 将规则集内容整理为不含 tag 的规则列表
+// 忽略空行和注释，BuildTemplate 与 /ruleset/:hash 共用
+// 支持逐行的规则列表以及 payload: 格式的 YAML 规则集，behavior 见 RulesetBehaviors
+// dialect 见 RuleDialects，为空时自动判断；Surge / Quantumult X 规则会被转为 Clash 规则，
+// 无法转换或不支持的规则放入 dropped，条目格式错误时返回包含行号的错误
+func normalizeRuleset(content string, behavior string, dialect string) (rules []*Rule, dropped []DroppedItem, err error) {
+	lines, isYaml, err := rulesetPayload(content)
+	if err != nil {
+		return
+	}
+	if !isYaml {
+		for i, text := range strings.Split(content, "\n") {
+			lines = append(lines, rulesetLine{number: i + 1, text: text})
+		}
+	}
+
+	d, err := selectRuleDialect(dialect, lines)
+	if err != nil {
+		return
+	}
+
+	rules = make([]*Rule, 0, len(lines))
+	for _, line := range lines {
+		text := strings.TrimSpace(line.text)
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		rule, e := parseRulesetLine(text, behavior, d)
+		if e != nil {
+			return nil, nil, fmt.Errorf("line %d: %w: %s", line.number, e, truncateText(text, 128))
+		}
+		if rule == nil {
+			dropped = append(dropped, DroppedItem{Kind: "rule", Item: text})
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return
+}
+
+// parseRulesetLine 解析并校验规则集条目，d 不为 nil 时先转为 Clash 规则
+// 无法转换、不支持的规则类型以及未知的 GEOIP 代码返回 nil
+func parseRulesetLine(text string, behavior string, d *ruleDialect) (*Rule, error) {
+	text, err := rulesetEntryRule(text, behavior)
+	if err != nil {
+		return nil, err
+	}
+
+	if d != nil {
+		var ok bool
+		text, ok = d.translate(text)
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	rule, err := ParseRule(text, false)
+	if err != nil {
+		return nil, err
+	}
+	if !RuleTypes.Has(rule.Type) {
+		return nil, nil
+	}
+
+	err = rule.Validate()
+	if errors.Is(err, errUnknownGeoIPCode) {
+		return nil, nil
+	}
+	return rule, err
+}
+
+// truncateText 截断过长的文本，避免错误信息中包含整个规则集
+func truncateText(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "..."
+}
+
+// rulesetPayloadPattern 匹配 YAML 规则集顶层的 payload 键
+var rulesetPayloadPattern = regexp.MustCompile(`(?m)^payload:`)
+
+// rulesetPayload 读取 YAML 规则集的 payload 条目及其行号，内容不是 YAML 规则集时 isYaml=false
+func rulesetPayload(content string) (lines []rulesetLine, isYaml bool, err error) {
+	if !rulesetPayloadPattern.MatchString(content) {
+		return
+	}
+
+	var ruleset struct {
+		Payload []yaml.Node `yaml:"payload"`
+	}
+	err = yaml.Unmarshal([]byte(content), &ruleset)
+	if err != nil {
+		err = fmt.Errorf("invalid yaml ruleset: %w", err)
+		return
+	}
+
+	for _, node := range ruleset.Payload {
+		if node.Kind != yaml.ScalarNode {
+			err = fmt.Errorf("line %d: payload entry must be a string", node.Line)
+			return
+		}
+		lines = append(lines, rulesetLine{number: node.Line, text: node.Value})
+	}
+
+	return lines, true, nil
+}
+
+// RulesetBehaviors 规则集的行为，与 rule-providers 的 behavior 一致，空字符串表示按条目内容自动判断
+var RulesetBehaviors = NewSet("", "classical", "domain", "ipcidr")
+
+// domainEntryPattern domain 行为规则集中合法的条目
+var domainEntryPattern = regexp.MustCompile(`^[\w*+.-]+$`)
+
+// rulesetEntryRule 将规则集条目转为规则
+// classical 条目原样返回，domain 和 ipcidr 条目转为对应的规则，自动判断时含逗号的条目视为 classical
+func rulesetEntryRule(entry string, behavior string) (string, error) {
+	switch behavior {
+	case "classical":
+		return entry, nil
+	case "domain":
+		return domainEntryRule(entry)
+	case "ipcidr":
+		return cidrEntryRule(entry)
+	}
+
+	if strings.Contains(entry, ",") {
+		return entry, nil
+	}
+	if rule, err := cidrEntryRule(entry); err == nil {
+		return rule, nil
+	}
+	return domainEntryRule(entry)
+}
+
+// domainEntryRule 转换 domain 条目
+// +.example.com 转为 DOMAIN-SUFFIX；.example.com 只匹配子域名、不匹配 example.com 本身，转为 DOMAIN-REGEX ^.+\.example\.com$；
+// 含 * 的转为 DOMAIN-REGEX，其余转为 DOMAIN
+func domainEntryRule(entry string) (string, error) {
+	if !domainEntryPattern.MatchString(entry) {
+		return "", fmt.Errorf("invalid domain ruleset entry")
+	}
+
+	switch {
+	case strings.HasPrefix(entry, "+."):
+		return "DOMAIN-SUFFIX," + entry[2:], nil
+	case strings.HasPrefix(entry, "."):
+		return "DOMAIN-REGEX,^.+" + domainEntryRegex(entry) + "$", nil
+	case strings.Contains(entry, "*"):
+		return "DOMAIN-REGEX,^" + domainEntryRegex(entry) + "$", nil
+	default:
+		return "DOMAIN," + entry, nil
+	}
+}
+
+// domainEntryRegex 将 domain 条目转为正则（不含 ^ 和 $），* 匹配单级子域名
+func domainEntryRegex(entry string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(entry), `\*`, `[^.]+`)
+}
+
+// cidrEntryRule 转换 ipcidr 条目，单个地址视为 /32 或 /128
+func cidrEntryRule(entry string) (string, error) {
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		addr, e := netip.ParseAddr(entry)
+		if e != nil {
+			return "", fmt.Errorf("invalid ipcidr ruleset entry")
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	if prefix.Addr().Is4() {
+		return "IP-CIDR," + prefix.String(), nil
+	}
+	return "IP-CIDR6," + prefix.String(), nil
+}
+
 // Marshal 将配置序列化为 YAML 字符串
 func Marshal(y map[string]any) (result string, err error) {
 	resultBytes, err := yaml.Marshal(y)
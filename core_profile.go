@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CoreProfile 不同 Clash 内核的能力表，字段为 nil 表示不做限制
+type CoreProfile struct {
+	ProxyTypes  Set
+	RuleTypes   Set // 以 RuleTypes 为基础的子集，MATCH 始终保留
+	GroupTypes  Set
+	RuleOptions Set // 规则末尾允许的附加参数，例如 no-resolve
+
+	// 不支持的节点字段，直接删除
+	ProxyFields []string
+	// 不支持的策略组字段，直接删除
+	GroupFields []string
+	// 返回节点不受支持的原因，空字符串表示支持
+	Unsupported func(proxy map[string]any) string
+}
+
+// pick 从集合中挑选出指定的元素，不在集合中的元素会被忽略
+func (s Set) pick(e ...string) (result Set) {
+	result = NewSet()
+	for _, v := range e {
+		if s.Has(v) {
+			result[v] = true
+		}
+	}
+	return
+}
+
+// metaOnlyProxyFields mihomo 扩展的节点字段，原版内核不识别
+var metaOnlyProxyFields = []string{
+	"client-fingerprint", "fingerprint", "flow", "udp-over-tcp", "udp-over-tcp-version",
+	"smux", "ip-version", "dialer-proxy", "tfo", "mptcp", "interface-name", "routing-mark",
+	"packet-encoding", "global-padding", "authenticated-length", "xudp",
+}
+
+// metaOnlyGroupFields mihomo 扩展的策略组字段
+var metaOnlyGroupFields = []string{
+	"include-all", "include-all-proxies", "include-all-providers", "filter",
+	"exclude-filter", "exclude-type", "expected-status", "hidden", "icon",
+}
+
+// clashRuleTypes 原版 Clash 支持的规则类型
+var clashRuleTypes = RuleTypes.pick(
+	"DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD", "GEOIP", "IP-CIDR", "IP-CIDR6",
+	"SRC-IP-CIDR", "SRC-PORT", "DST-PORT", "PROCESS-NAME", "PROCESS-PATH",
+)
+
+// CoreProfiles 支持的内核，meta（mihomo）为默认值不做任何处理
+var CoreProfiles = map[string]*CoreProfile{
+	"clash": {
+		ProxyTypes:  NewSet("ss", "ssr", "vmess", "trojan", "snell", "http", "socks5"),
+		RuleTypes:   clashRuleTypes,
+		GroupTypes:  NewSet("select", "url-test", "fallback", "load-balance", "relay"),
+		RuleOptions: NewSet("no-resolve"),
+		ProxyFields: metaOnlyProxyFields,
+		GroupFields: metaOnlyGroupFields,
+		Unsupported: unsupportedByClash,
+	},
+	"premium": {
+		ProxyTypes: NewSet("ss", "ssr", "vmess", "trojan", "snell", "http", "socks5"),
+		RuleTypes: RuleTypes.pick(
+			"DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD", "GEOIP", "IP-CIDR", "IP-CIDR6",
+			"SRC-IP-CIDR", "SRC-PORT", "DST-PORT", "PROCESS-NAME", "PROCESS-PATH", "RULE-SET",
+		),
+		GroupTypes:  NewSet("select", "url-test", "fallback", "load-balance", "relay"),
+		RuleOptions: NewSet("no-resolve"),
+		ProxyFields: metaOnlyProxyFields,
+		GroupFields: metaOnlyGroupFields,
+		Unsupported: unsupportedByClash,
+	},
+	"meta": nil,
+	"stash": {
+		ProxyTypes: NewSet(
+			"ss", "ssr", "vmess", "vless", "trojan", "snell", "http", "socks5",
+			"hysteria", "hysteria2", "tuic", "wireguard",
+		),
+		RuleTypes: RuleTypes.pick(
+			"DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD", "GEOSITE", "GEOIP", "IP-CIDR", "IP-CIDR6",
+			"IP-ASN", "DST-PORT", "SRC-PORT", "PROCESS-NAME", "PROCESS-PATH", "RULE-SET",
+			"AND", "OR", "NOT",
+		),
+		GroupTypes:  NewSet("select", "url-test", "fallback", "load-balance"),
+		ProxyFields: []string{"smux", "dialer-proxy"},
+	},
+}
+
+// unsupportedByClash 检查原版 Clash 内核不支持的节点特性
+func unsupportedByClash(proxy map[string]any) string {
+	if _, ok := proxy["reality-opts"]; ok {
+		return "reality"
+	}
+	if cipher := anyToString(proxy["cipher"]); strings.HasPrefix(cipher, "2022-") {
+		return "cipher " + cipher
+	}
+	if plugin := anyToString(proxy["plugin"]); plugin != "" && plugin != "obfs" && plugin != "v2ray-plugin" {
+		return "plugin " + plugin
+	}
+	switch network := anyToString(proxy["network"]); network {
+	case "", "tcp", "http", "h2", "grpc":
+	case "ws":
+		wsOpts, _ := proxy["ws-opts"].(map[string]any)
+		if anyToBool(wsOpts["v2ray-http-upgrade"]) {
+			return "httpupgrade"
+		}
+	default:
+		return "network " + network
+	}
+	return ""
+}
+
+// ruleTypeAndTarget 读取规则类型和目标策略，逻辑规则的目标位于 payload 的括号之后
+func ruleTypeAndTarget(rule string) (ruleType string, target string, ok bool) {
+	ruleType, _, _ = strings.Cut(rule, ",")
+	ruleType = strings.ToUpper(strings.TrimSpace(ruleType))
+
+	if LogicalRuleTypes.Has(ruleType) {
+		_, _, tail, err := splitLogicalRule(rule)
+		if err != nil || len(tail) == 0 || tail[0] == "" {
+			return
+		}
+		return ruleType, tail[0], true
+	}
+
+	ruleType, _, target, _, ok = splitRule(rule)
+	return
+}
+
+// applyCoreProfile 按内核能力表删除或改写不支持的节点、字段、策略组和规则
+// 因此变空的策略组以及指向被删除策略的规则也会一并移除
+func applyCoreProfile(yamlStr string, profile *CoreProfile) (result string, dropped []DroppedItem, err error) {
+	var config map[string]any
+	err = yaml.Unmarshal([]byte(yamlStr), &config)
+	if err != nil {
+		return
+	}
+
+	var render RenderResult
+	valid := NewSet("DIRECT", "REJECT", "REJECT-DROP", "PASS", "COMPATIBLE", "GLOBAL")
+
+	proxies := make([]any, 0)
+	for _, proxy := range configProxies(config) {
+		name := anyToString(proxy["name"])
+		proxyType := anyToString(proxy["type"])
+		if profile.ProxyTypes != nil && !profile.ProxyTypes.Has(proxyType) {
+			render.drop("proxy", fmt.Sprintf("%s (%s)", name, proxyType))
+			continue
+		}
+		if profile.Unsupported != nil {
+			if reason := profile.Unsupported(proxy); reason != "" {
+				render.drop("proxy", fmt.Sprintf("%s (%s)", name, reason))
+				continue
+			}
+		}
+		for _, field := range profile.ProxyFields {
+			delete(proxy, field)
+		}
+		valid[name] = true
+		proxies = append(proxies, proxy)
+	}
+	config["proxies"] = proxies
+
+	groups := make([]map[string]any, 0)
+	for _, group := range configGroups(config) {
+		groupType := anyToString(group["type"])
+		if profile.GroupTypes != nil && !profile.GroupTypes.Has(groupType) {
+			render.drop("group", fmt.Sprintf("%s (%s)", anyToString(group["name"]), groupType))
+			continue
+		}
+		for _, field := range profile.GroupFields {
+			delete(group, field)
+		}
+		groups = append(groups, group)
+	}
+
+	keptGroups := make([]any, 0)
+	for _, group := range pruneGroups(groups, valid, &render) {
+		keptGroups = append(keptGroups, group)
+	}
+	config["proxy-groups"] = keptGroups
+
+	rules := make([]string, 0)
+	for _, rule := range configRules(config) {
+		ruleType, target, ok := ruleTypeAndTarget(rule)
+		if !ok || !valid.Has(target) {
+			render.drop("rule", rule)
+			continue
+		}
+		if ruleType != "MATCH" && profile.RuleTypes != nil && !profile.RuleTypes.Has(ruleType) {
+			render.drop("rule", rule)
+			continue
+		}
+		if profile.RuleOptions != nil && !LogicalRuleTypes.Has(ruleType) {
+			rule = stripRuleOptions(rule, profile.RuleOptions)
+		}
+		rules = append(rules, rule)
+	}
+	config["rules"] = rules
+
+	result, err = Marshal(config)
+	dropped = render.Dropped
+	return
+}
+
+// stripRuleOptions 删除规则末尾不受支持的附加参数
+func stripRuleOptions(rule string, allowed Set) string {
+	ruleType, payload, target, options, ok := splitRule(rule)
+	if !ok || len(options) == 0 {
+		return rule
+	}
+
+	parts := []string{ruleType}
+	if ruleType != "MATCH" {
+		parts = append(parts, payload)
+	}
+	parts = append(parts, target)
+	for _, option := range options {
+		if allowed.Has(option) {
+			parts = append(parts, option)
+		}
+	}
+	if len(parts) == len(options)+3 {
+		return rule
+	}
+	return strings.Join(parts, ",")
+}
@@ -19,6 +19,15 @@ type File struct {
 	Content string `gorm:"type:text"`
 }
 
+// RulesetRef rule-providers 中 /ruleset/:hash 对应的规则集地址
+type RulesetRef struct {
+	gorm.Model
+	Hash     string `gorm:"uniqueIndex"`
+	Url      string `gorm:"type:text"`
+	Behavior string
+	Options  string `gorm:"type:text"` // RulesetOptions 的 JSON，未设置选项时为空
+}
+
 type ShortUrl struct {
 	gorm.Model
 	Code      string `gorm:"uniqueIndex"`
@@ -44,7 +53,7 @@ func InitDb() {
 		panic("failed to connect database: " + err.Error())
 	}
 
-	err = orm.AutoMigrate(&File{}, &ShortUrl{})
+	err = orm.AutoMigrate(&File{}, &ShortUrl{}, &RulesetRef{})
 	if err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -53,6 +62,13 @@ func InitDb() {
 }
 
 func GetOrPut(url string, contentSupplier func(string) (string, error)) (result string, err error) {
+	return GetOrPutWithExpire(url, CacheExpire, contentSupplier)
+}
+
+// GetOrPutWithExpire 与 GetOrPut 相同，但使用指定的缓存过期时间
+func GetOrPutWithExpire(
+	url string, expire time.Duration, contentSupplier func(string) (string, error),
+) (result string, err error) {
 	if strings.Contains(url, "?") {
 		return contentSupplier(url)
 	}
@@ -60,7 +76,7 @@ func GetOrPut(url string, contentSupplier func(string) (string, error)) (result
 	var file File
 	err = orm.First(&file, "url = ?", url).Error
 	if err == nil {
-		if file.UpdatedAt.After(time.Now().Add(-CacheExpire)) {
+		if file.UpdatedAt.After(time.Now().Add(-expire)) {
 			L().Info(fmt.Sprintf("Using cache: %s", url))
 			result = file.Content
 			return
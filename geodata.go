@@ -0,0 +1,461 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"google.golang.org/protobuf/encoding/protowire"
+	"gopkg.in/yaml.v3"
+)
+
+// GeositeFiles / GeoipFiles 数据目录中依次查找的文件，geoip 优先使用 geoip.dat，其次为 mmdb
+var (
+	GeositeFiles = []string{"geosite.dat"}
+	GeoipFiles   = []string{"geoip.dat", "geoip.metadb", "Country.mmdb", "GeoLite2-Country.mmdb"}
+)
+
+// geositeRuleTypes geosite.dat 中的域名类型（Plain / Regex / Domain / Full）对应的规则类型
+var geositeRuleTypes = []string{"DOMAIN-KEYWORD", "DOMAIN-REGEX", "DOMAIN-SUFFIX", "DOMAIN"}
+
+// geositeDomain geosite 分类中的一个域名
+type geositeDomain struct {
+	ruleType   string
+	value      string
+	attributes []string
+}
+
+// geodataCache 缓存解析后的数据文件，文件修改后重新解析
+type geodataCache[T any] struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	value   T
+}
+
+var (
+	geositeCache = &geodataCache[map[string][]geositeDomain]{}
+	geoipCache   = &geodataCache[map[string][]netip.Prefix]{}
+)
+
+// load 在数据目录中查找第一个存在的文件并解析，文件未变化时直接返回缓存
+func (c *geodataCache[T]) load(names []string, parse func(path string, data []byte) (T, error)) (value T, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		path := filepath.Join(GeodataDir, name)
+		info, e := os.Stat(path)
+		if e != nil {
+			continue
+		}
+		if path == c.path && info.ModTime().Equal(c.modTime) {
+			return c.value, nil
+		}
+
+		data, e := os.ReadFile(path)
+		if e != nil {
+			return value, e
+		}
+		value, err = parse(path, data)
+		if err != nil {
+			return value, fmt.Errorf("%s: %w", path, err)
+		}
+		L().Info(fmt.Sprintf("Loaded geodata %s", path))
+		c.path, c.modTime, c.value = path, info.ModTime(), value
+		return
+	}
+
+	return value, fmt.Errorf("%s not found in %s", strings.Join(names, " / "), GeodataDir)
+}
+
+// loadGeosite 读取 geosite 分类，分类名为小写
+func loadGeosite() (map[string][]geositeDomain, error) {
+	return geositeCache.load(GeositeFiles, func(_ string, data []byte) (map[string][]geositeDomain, error) {
+		return parseGeositeDat(data)
+	})
+}
+
+// loadGeoip 读取 geoip 代码对应的网段，代码为小写
+func loadGeoip() (map[string][]netip.Prefix, error) {
+	return geoipCache.load(GeoipFiles, func(path string, data []byte) (map[string][]netip.Prefix, error) {
+		if strings.HasSuffix(path, ".dat") {
+			return parseGeoipDat(data)
+		}
+		return parseMmdb(data)
+	})
+}
+
+// protoFields 遍历 protobuf 消息的字段，varint 字段通过 v 传入，bytes 字段通过 b 传入，其它类型的字段被跳过
+func protoFields(data []byte, fn func(num protowire.Number, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, m := protowire.ConsumeVarint(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+			n = m
+		case protowire.BytesType:
+			b, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			if err := fn(num, 0, b); err != nil {
+				return err
+			}
+			n = m
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// parseGeositeDat 解析 v2ray 格式的 geosite.dat：
+// GeoSiteList{entry=1: GeoSite{country_code=1, domain=2: Domain{type=1, value=2, attribute=3: Attribute{key=1}}}}
+func parseGeositeDat(data []byte) (sites map[string][]geositeDomain, err error) {
+	sites = make(map[string][]geositeDomain)
+	err = protoFields(data, func(num protowire.Number, _ uint64, site []byte) error {
+		if num != 1 {
+			return nil
+		}
+
+		var code string
+		var domains []geositeDomain
+		err := protoFields(site, func(num protowire.Number, _ uint64, b []byte) error {
+			switch num {
+			case 1:
+				code = strings.ToLower(string(b))
+			case 2:
+				domain := geositeDomain{ruleType: geositeRuleTypes[0]}
+				err := protoFields(b, func(num protowire.Number, v uint64, b []byte) error {
+					switch num {
+					case 1:
+						if v >= uint64(len(geositeRuleTypes)) {
+							return fmt.Errorf("unknown geosite domain type: %d", v)
+						}
+						domain.ruleType = geositeRuleTypes[v]
+					case 2:
+						domain.value = string(b)
+					case 3:
+						return protoFields(b, func(num protowire.Number, _ uint64, b []byte) error {
+							if num == 1 {
+								domain.attributes = append(domain.attributes, strings.ToLower(string(b)))
+							}
+							return nil
+						})
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				domains = append(domains, domain)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sites[code] = append(sites[code], domains...)
+		return nil
+	})
+	return
+}
+
+// parseGeoipDat 解析 v2ray 格式的 geoip.dat：
+// GeoIPList{entry=1: GeoIP{country_code=1, cidr=2: CIDR{ip=1, prefix=2}, reverse_match=3}}
+// reverse_match 的条目无法展开为网段，会被忽略
+func parseGeoipDat(data []byte) (ips map[string][]netip.Prefix, err error) {
+	ips = make(map[string][]netip.Prefix)
+	err = protoFields(data, func(num protowire.Number, _ uint64, entry []byte) error {
+		if num != 1 {
+			return nil
+		}
+
+		var code string
+		var prefixes []netip.Prefix
+		reverse := false
+		err := protoFields(entry, func(num protowire.Number, v uint64, b []byte) error {
+			switch num {
+			case 1:
+				code = strings.ToLower(string(b))
+			case 2:
+				var addr netip.Addr
+				var bits uint64
+				err := protoFields(b, func(num protowire.Number, v uint64, b []byte) error {
+					switch num {
+					case 1:
+						var ok bool
+						if addr, ok = netip.AddrFromSlice(b); !ok {
+							return fmt.Errorf("invalid geoip address: %x", b)
+						}
+					case 2:
+						bits = v
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				if addr.Is4In6() {
+					addr, bits = addr.Unmap(), bits-96
+				}
+				prefix, err := addr.Prefix(int(bits))
+				if err != nil {
+					return fmt.Errorf("invalid geoip cidr: %s/%d", addr, bits)
+				}
+				prefixes = append(prefixes, prefix)
+			case 3:
+				reverse = v != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if reverse {
+			L().Warn(fmt.Sprintf("Skipped reverse-match geoip entry: %s", code))
+			return nil
+		}
+		ips[code] = append(ips[code], prefixes...)
+		return nil
+	})
+	return
+}
+
+// parseMmdb 解析 MaxMind 格式的 mmdb，记录可以是 GeoLite2 的 country.iso_code，
+// 也可以是 sing-geoip / mihomo metadb 中的代码字符串或字符串数组
+func parseMmdb(data []byte) (ips map[string][]netip.Prefix, err error) {
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return
+	}
+
+	ips = make(map[string][]netip.Prefix)
+	networks := reader.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		var record any
+		network, e := networks.Network(&record)
+		if e != nil {
+			return nil, e
+		}
+
+		addr, _ := netip.AddrFromSlice(network.IP)
+		bits, _ := network.Mask.Size()
+		if addr.Is4In6() {
+			addr, bits = addr.Unmap(), bits-96
+		}
+		prefix := netip.PrefixFrom(addr, bits)
+		for _, code := range mmdbCodes(record) {
+			code = strings.ToLower(code)
+			ips[code] = append(ips[code], prefix)
+		}
+	}
+	return ips, networks.Err()
+}
+
+// mmdbCodes 读取 mmdb 记录中的代码
+func mmdbCodes(record any) []string {
+	switch r := record.(type) {
+	case string:
+		return []string{r}
+	case []any:
+		codes := make([]string, 0, len(r))
+		for _, code := range r {
+			codes = append(codes, anyToString(code))
+		}
+		return codes
+	case map[string]any:
+		if country, ok := r["country"].(map[string]any); ok {
+			if code := anyToString(country["iso_code"]); code != "" {
+				return []string{code}
+			}
+		}
+	}
+	return nil
+}
+
+// geositeRules 将 geosite 分类展开为不含 target 的规则，payload 可以带 @属性 只保留带有该属性的域名，例如 google@cn
+func geositeRules(sites map[string][]geositeDomain, payload string) (rules []*Rule, found bool) {
+	name, attribute, _ := strings.Cut(strings.ToLower(payload), "@")
+	domains, found := sites[name]
+	if !found {
+		return
+	}
+
+	seen := NewSet()
+	for _, domain := range domains {
+		if attribute != "" && !slices.Contains(domain.attributes, attribute) {
+			continue
+		}
+		key := domain.ruleType + "," + domain.value
+		if seen.Has(key) {
+			continue
+		}
+		seen[key] = true
+		rules = append(rules, &Rule{Type: domain.ruleType, Payload: domain.value})
+	}
+	return
+}
+
+// geoipRules 将 geoip 代码展开为不含 target 的 CIDR 规则，LAN 不存在时使用 private
+func geoipRules(ips map[string][]netip.Prefix, code string, src bool) (rules []*Rule, found bool) {
+	code = strings.ToLower(code)
+	prefixes, found := ips[code]
+	if !found && code == "lan" {
+		prefixes, found = ips["private"]
+	}
+	if !found {
+		return
+	}
+
+	for _, prefix := range aggregatePrefixes(prefixes) {
+		ruleType := "IP-CIDR"
+		switch {
+		case src:
+			ruleType = "SRC-IP-CIDR"
+		case prefix.Addr().Is6():
+			ruleType = "IP-CIDR6"
+		}
+		rules = append(rules, &Rule{Type: ruleType, Payload: prefix.String()})
+	}
+	return
+}
+
+// expandGeoRules 将配置中的 GEOSITE / GEOIP / SRC-GEOIP 规则展开为 DOMAIN / IP-CIDR 等规则，target 和附加参数保持不变
+// 数据目录中没有对应的文件时返回错误；分类不存在的规则以及逻辑规则中的条件保持原样
+func expandGeoRules(yamlStr string) (result string, err error) {
+	var config map[string]any
+	err = yaml.Unmarshal([]byte(yamlStr), &config)
+	if err != nil {
+		return
+	}
+
+	var sites map[string][]geositeDomain
+	var ips map[string][]netip.Prefix
+	rules := make([]string, 0)
+	expanded := 0
+	for _, line := range configRules(config) {
+		rule, e := ParseRule(line, true)
+		if e != nil {
+			rules = append(rules, line)
+			continue
+		}
+
+		var geoRules []*Rule
+		found := false
+		switch rule.Type {
+		case "GEOSITE":
+			if sites == nil {
+				if sites, err = loadGeosite(); err != nil {
+					return
+				}
+			}
+			geoRules, found = geositeRules(sites, rule.Payload)
+		case "GEOIP", "SRC-GEOIP":
+			if ips == nil {
+				if ips, err = loadGeoip(); err != nil {
+					return
+				}
+			}
+			geoRules, found = geoipRules(ips, rule.Payload, rule.Type == "SRC-GEOIP")
+		default:
+			rules = append(rules, line)
+			continue
+		}
+
+		if !found {
+			L().Warn(fmt.Sprintf("Geodata has no entry for %s, keeping rule: %s", rule.Payload, line))
+			rules = append(rules, line)
+			continue
+		}
+		for _, r := range geoRules {
+			r.Target, r.Options = rule.Target, rule.Options
+			rules = append(rules, r.String())
+		}
+		expanded++
+	}
+
+	if expanded > 0 {
+		L().Info(fmt.Sprintf("Expanded %d geodata rules: %d -> %d", expanded, len(configRules(config)), len(rules)))
+	}
+	config["rules"] = rules
+	return Marshal(config)
+}
+
+// GeositeCategory geosite 分类的摘要
+type GeositeCategory struct {
+	Name       string   `json:"name"`
+	Count      int      `json:"count"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+// ListGeosite 列出 geosite.dat 中的所有分类，按名称排序
+func ListGeosite() (categories []GeositeCategory, err error) {
+	sites, err := loadGeosite()
+	if err != nil {
+		return
+	}
+
+	categories = make([]GeositeCategory, 0, len(sites))
+	for name, domains := range sites {
+		attributes := NewSet()
+		for _, domain := range domains {
+			for _, attribute := range domain.attributes {
+				attributes[attribute] = true
+			}
+		}
+		category := GeositeCategory{Name: name, Count: len(domains)}
+		for attribute := range attributes {
+			category.Attributes = append(category.Attributes, attribute)
+		}
+		sort.Strings(category.Attributes)
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+	return
+}
+
+// RenderGeosite 输出 geosite 分类展开后的规则，每行一条，不含 target
+func RenderGeosite(category string) (string, error) {
+	sites, err := loadGeosite()
+	if err != nil {
+		return "", err
+	}
+
+	rules, found := geositeRules(sites, category)
+	if !found {
+		return "", fmt.Errorf("geosite category not found: %s", category)
+	}
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, rule.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -9,15 +9,21 @@ import (
 )
 
 type Ruleset struct {
-	tag     string
-	url     string
-	content string
+	tag      string
+	url      string
+	behavior string
+	options  RulesetOptions
+	content  string
+	skipped  bool // optional 规则集下载失败
 }
 
 // downloadRulesets 并发下载规则集，保持调用顺序
 // 从 JS 的 rulesets() 函数中提取规则集 URL，并发下载但按原始顺序返回
-func downloadRulesets(vm *goja.Runtime) (resultLines []*Ruleset, err error) {
-	rulesetsFunc := func(func(string, string)) {}
+// download 为 false 时只收集 tag、url、behavior 和选项，不下载内容
+// JS 中以 r(tag, url[, behavior | options]) 注册规则集，behavior 省略时按条目内容自动判断，options 见 RulesetOptions
+// url 末尾可以带 #dialect=surge|quanx|clash 指定规则方言，下载时去掉该片段
+func downloadRulesets(vm *goja.Runtime, download bool) (resultLines []*Ruleset, err error) {
+	rulesetsFunc := func(func(string, string, goja.Value)) {}
 	jsRulesetsFunc := vm.Get("rulesets")
 
 	if jsRulesetsFunc == nil {
@@ -32,57 +38,71 @@ func downloadRulesets(vm *goja.Runtime) (resultLines []*Ruleset, err error) {
 
 	errGroup := new(errgroup.Group)
 	limiter := make(chan bool, 8)
-	urlList := make([]string, 0, 8)
-	resultCh := make(chan *Ruleset, 8)
 
-	rulesetsFunc(func(tag string, url string) {
-		urlList = append(urlList, url)
+	rulesetsFunc(func(tag string, url string, value goja.Value) {
+		behavior, options, e := parseRulesetOptions(value)
+		if e != nil {
+			errGroup.Go(func() error {
+				return fmt.Errorf("%w (%s)", e, url)
+			})
+			return
+		}
+		if !RulesetBehaviors.Has(behavior) {
+			errGroup.Go(func() error {
+				return fmt.Errorf("unsupported ruleset behavior: %s (%s)", behavior, url)
+			})
+			return
+		}
+		cleanUrl, dialect := splitDialectHint(url)
+		if _, ok := RuleDialects[dialect]; dialect != "" && !ok {
+			errGroup.Go(func() error {
+				return fmt.Errorf("unsupported ruleset dialect: %s (%s)", dialect, url)
+			})
+			return
+		}
+
+		// 每个规则集单独占一个位置，同一地址以不同 tag 或 behavior 注册时互不覆盖
+		ruleset := &Ruleset{tag: tag, url: url, behavior: behavior, options: options}
+		resultLines = append(resultLines, ruleset)
+		if !download {
+			return
+		}
+
 		errGroup.Go(func() error {
 			limiter <- true
 			defer func() {
 				<-limiter
 			}()
 
-			content, e := GetOrPut(url, FetchString)
+			content, e := GetOrPutWithExpire(cleanUrl, options.expire(), fetchRuleset)
+			if e != nil && options.Optional {
+				L().Warn(fmt.Sprintf("Skipped optional ruleset %s: %s", url, e.Error()))
+				ruleset.skipped = true
+				return nil
+			}
 			if e != nil {
 				return e
 			}
 
-			resultCh <- &Ruleset{
-				tag:     tag,
-				url:     url,
-				content: content,
-			}
+			ruleset.content = content
 			return nil
 		})
 	})
 
-	resultMap := make(map[string]*Ruleset)
-	collected := make(chan bool, 1)
-	go func() {
-		for line := range resultCh {
-			resultMap[line.url] = line
-		}
-		collected <- true
-	}()
-
 	err = errGroup.Wait()
-	close(resultCh)
 	if err != nil {
 		return nil, err
 	}
 
-	<-collected
-	resultLines = make([]*Ruleset, len(urlList))
-	for i, url := range urlList {
-		resultLines[i] = resultMap[url]
-	}
-
 	return
 }
 
 // ExecJs 执行 JS 脚本，支持 rulesets 和 buildConfig 函数
-func ExecJs(script string, template string, proxies SubscriptionData) (result string, err error) {
+// rulesetBaseUrl 不为空时以 rule-providers 形式输出规则集，此时不下载规则集内容
+// rulesetFormat 为 mrs 时，声明了 domain / ipcidr 行为的规则集以 .mrs 格式输出
+func ExecJs(
+	script string, template string, proxies SubscriptionData, rulesetBaseUrl string, rulesetFormat string,
+) (result string, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("[panic] %v\n%s", r, string(debug.Stack()))
@@ -102,12 +122,12 @@ func ExecJs(script string, template string, proxies SubscriptionData) (result st
 		return
 	}
 
-	ruleLines, err := downloadRulesets(vm)
+	ruleLines, err := downloadRulesets(vm, rulesetBaseUrl == "")
 	if err != nil {
 		return
 	}
 
-	conf, err := BuildTemplate(template, proxies, ruleLines)
+	conf, err := BuildTemplate(template, proxies, ruleLines, rulesetBaseUrl, rulesetFormat)
 	if err != nil {
 		return
 	}
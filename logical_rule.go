@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitLogicalRule 拆分逻辑规则，payload 为包含外层括号的完整条件，rest 为其后以逗号分隔的 target 和附加参数
+// 例如 AND,((DOMAIN,a.com),(NETWORK,UDP)),PROXY 拆分为 AND、((DOMAIN,a.com),(NETWORK,UDP))、[PROXY]
+func splitLogicalRule(rule string) (ruleType string, payload string, rest []string, err error) {
+	ruleType, body, _ := strings.Cut(rule, ",")
+	ruleType = strings.ToUpper(strings.TrimSpace(ruleType))
+	body = strings.TrimSpace(body)
+
+	if !LogicalRuleTypes.Has(ruleType) {
+		err = fmt.Errorf("not a logical rule: %s", rule)
+		return
+	}
+	if !strings.HasPrefix(body, "(") {
+		err = fmt.Errorf("logical rule payload must be parenthesized: %s", rule)
+		return
+	}
+
+	end, err := matchParen(body, 0)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", err, rule)
+		return
+	}
+	payload = body[:end+1]
+
+	tail := strings.TrimSpace(body[end+1:])
+	if tail == "" {
+		return
+	}
+	if !strings.HasPrefix(tail, ",") {
+		err = fmt.Errorf("unexpected content after logical rule payload: %s", rule)
+		return
+	}
+	for _, part := range strings.Split(tail[1:], ",") {
+		rest = append(rest, strings.TrimSpace(part))
+	}
+	return
+}
+
+// matchParen 返回与 start 处左括号匹配的右括号位置
+func matchParen(s string, start int) (int, error) {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unbalanced parentheses")
+}
+
+// splitConditions 将 ((A),(B)) 形式的 payload 拆分为各个子条件，子条件不含外层括号
+func splitConditions(payload string) (conditions []string, err error) {
+	inner := strings.TrimSpace(payload[1 : len(payload)-1])
+	for i := 0; i < len(inner); {
+		switch inner[i] {
+		case ' ', ',':
+			i++
+			continue
+		case '(':
+		default:
+			return nil, fmt.Errorf("sub-rule must be parenthesized: %s", payload)
+		}
+
+		end, e := matchParen(inner, i)
+		if e != nil {
+			return nil, fmt.Errorf("%w: %s", e, payload)
+		}
+		conditions = append(conditions, strings.TrimSpace(inner[i+1:end]))
+		i = end + 1
+	}
+	return
+}
+
+// validateLogicalRule 校验逻辑规则的 payload 及其中嵌套的子规则
+// AND / OR 至少一个子条件，NOT 恰好一个，SUB-RULE 的 payload 本身就是一个条件
+func validateLogicalRule(ruleType string, payload string) error {
+	if ruleType == "SUB-RULE" {
+		return validateCondition(strings.TrimSpace(payload[1 : len(payload)-1]))
+	}
+
+	conditions, err := splitConditions(payload)
+	if err != nil {
+		return err
+	}
+	if len(conditions) == 0 {
+		return fmt.Errorf("%s rule requires at least one sub-rule: %s", ruleType, payload)
+	}
+	if ruleType == "NOT" && len(conditions) != 1 {
+		return fmt.Errorf("NOT rule requires exactly one sub-rule: %s", payload)
+	}
+
+	for _, condition := range conditions {
+		if err = validateCondition(condition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCondition 校验单个子条件，子条件为不含 target 的规则，可以继续嵌套逻辑规则
+func validateCondition(condition string) error {
+	rule, err := ParseRule(condition, false)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, condition)
+	}
+	if rule.Type == "SUB-RULE" || rule.Type == "MATCH" {
+		return fmt.Errorf("unsupported sub-rule type: %s", condition)
+	}
+	if err = rule.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", err, condition)
+	}
+	return nil
+}
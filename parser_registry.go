@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// SubscriptionParser 订阅解析器
+type SubscriptionParser interface {
+	// Name 解析器名称，用于显式指定及记录到 SubscriptionMeta
+	Name() string
+	// Detect 根据 Content-Type 和内容判断能否解析
+	Detect(contentType string, body string) bool
+	// Parse 将订阅内容解析为 Clash 节点，可补充订阅元信息
+	Parse(body string, meta *SubscriptionMeta) ([]map[string]any, error)
+}
+
+// funcParser 基于函数的解析器实现
+type funcParser struct {
+	name         string
+	contentTypes Set
+	detect       func(body string) bool
+	parse        func(body string, meta *SubscriptionMeta) ([]map[string]any, error)
+}
+
+func (p *funcParser) Name() string {
+	return p.name
+}
+
+func (p *funcParser) Detect(_ string, body string) bool {
+	return p.detect(body)
+}
+
+func (p *funcParser) Parse(body string, meta *SubscriptionMeta) ([]map[string]any, error) {
+	return p.parse(body, meta)
+}
+
+// AcceptContentType 判断解析器是否声明支持该 Content-Type
+func (p *funcParser) AcceptContentType(contentType string) bool {
+	return p.contentTypes.Has(contentType)
+}
+
+// contentTypeAcceptor 可声明所支持 Content-Type 的解析器
+type contentTypeAcceptor interface {
+	AcceptContentType(contentType string) bool
+}
+
+// SubscriptionParsers 已注册的解析器，按注册顺序嗅探
+var SubscriptionParsers = make([]SubscriptionParser, 0)
+
+// RegisterParser 注册订阅解析器
+func RegisterParser(parser SubscriptionParser) {
+	SubscriptionParsers = append(SubscriptionParsers, parser)
+}
+
+func init() {
+	RegisterParser(&funcParser{
+		name:         "uri",
+		contentTypes: NewSet("text/plain"),
+		detect: func(body string) bool {
+			_, ok := decodeUriList(body)
+			return ok
+		},
+		parse: func(body string, _ *SubscriptionMeta) ([]map[string]any, error) {
+			return parseUriList(body)
+		},
+	})
+	RegisterParser(&funcParser{
+		name:         "singbox",
+		contentTypes: NewSet("application/json"),
+		detect:       isSingBoxConfig,
+		parse: func(body string, _ *SubscriptionMeta) ([]map[string]any, error) {
+			return parseSingBoxConfig(body)
+		},
+	})
+	RegisterParser(&funcParser{
+		name:         "sip008",
+		contentTypes: NewSet("application/json"),
+		detect:       isSip008Config,
+		parse:        parseSip008Config,
+	})
+	RegisterParser(&funcParser{
+		name:         "wireguard",
+		contentTypes: NewSet(),
+		detect:       isWireGuardConf,
+		parse: func(body string, meta *SubscriptionMeta) ([]map[string]any, error) {
+			return parseWireGuardConf(body, meta.Name)
+		},
+	})
+	RegisterParser(&funcParser{
+		name:         "surge",
+		contentTypes: NewSet(),
+		detect:       isSurgeProxyList,
+		parse: func(body string, _ *SubscriptionMeta) ([]map[string]any, error) {
+			return parseSurgeProxyList(body)
+		},
+	})
+	RegisterParser(&funcParser{
+		name:         "clash",
+		contentTypes: NewSet("text/yaml", "application/yaml", "application/x-yaml", "text/x-yaml"),
+		detect:       isClashConfig,
+		parse: func(body string, _ *SubscriptionMeta) ([]map[string]any, error) {
+			return parseClashConfig(body)
+		},
+	})
+}
+
+// findParser 按名称查找解析器
+func findParser(name string) (SubscriptionParser, error) {
+	for _, parser := range SubscriptionParsers {
+		if parser.Name() == name {
+			return parser, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown parser: %s", name)
+}
+
+// selectParser 选择订阅解析器
+// 优先级：显式指定 > 声明支持该 Content-Type 且内容匹配 > 按注册顺序嗅探内容
+func selectParser(hint string, contentType string, body string) (SubscriptionParser, error) {
+	if hint != "" {
+		return findParser(hint)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, parser := range SubscriptionParsers {
+		acceptor, ok := parser.(contentTypeAcceptor)
+		if ok && acceptor.AcceptContentType(mediaType) && parser.Detect(contentType, body) {
+			return parser, nil
+		}
+	}
+
+	for _, parser := range SubscriptionParsers {
+		if parser.Detect(contentType, body) {
+			return parser, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no parser matched subscription content")
+}
+
+// splitParserHint 从订阅链接末尾的 #parser=xxx 片段中提取解析器名称
+// 取最后一个 #，避免与 data: 订阅内容中分享链接的节点名冲突
+func splitParserHint(subUrl string) (cleanUrl string, hint string) {
+	idx := strings.LastIndex(subUrl, "#")
+	if idx == -1 {
+		return subUrl, ""
+	}
+
+	hint, found := strings.CutPrefix(subUrl[idx+1:], "parser=")
+	if !found {
+		return subUrl, ""
+	}
+	return subUrl[:idx], hint
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProxyProviderInterval 生成的 proxy-providers 的更新间隔（秒）
+const ProxyProviderInterval = 3600
+
+// HealthCheckUrl proxy-providers 健康检查使用的地址
+const HealthCheckUrl = "https://www.gstatic.com/generate_204"
+
+// subscriptionProvider 单个订阅对应的 proxy-provider
+type subscriptionProvider struct {
+	name  string
+	url   string
+	names Set // 订阅中的节点名称
+}
+
+// providerUrl 生成指向 /provider 的订阅地址
+func providerUrl(baseUrl string, sub string) string {
+	query := url.Values{}
+	query.Set("sub", sub)
+	if Token != "" {
+		query.Set("token", Token)
+	}
+	return baseUrl + "/provider?" + query.Encode()
+}
+
+// newSubscriptionProviders 为每个订阅生成 provider，名称取订阅名称，重名时追加序号
+func newSubscriptionProviders(subs []string, allProxies []SubscriptionData, baseUrl string) []*subscriptionProvider {
+	providers := make([]*subscriptionProvider, 0, len(subs))
+	used := NewSet()
+
+	for i, sub := range subs {
+		name := fmt.Sprintf("订阅%02d", i+1)
+		if len(allProxies[i].SubInfos) > 0 && allProxies[i].SubInfos[0].Name != "" {
+			name = allProxies[i].SubInfos[0].Name
+		}
+		base := name
+		for n := 2; used.Has(name); n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[name] = true
+
+		names := NewSet()
+		for _, proxy := range allProxies[i].Proxies {
+			names[anyToString(proxy["name"])] = true
+		}
+
+		providers = append(providers, &subscriptionProvider{
+			name:  name,
+			url:   providerUrl(baseUrl, sub),
+			names: names,
+		})
+	}
+
+	return providers
+}
+
+// applyProxyProviders 将订阅节点从 proxies 中移除，改为通过 proxy-providers 引用
+// 引用了订阅节点的策略组改用 use，只引用了部分节点时用 filter 精确匹配原来的节点名称
+// 节点按名称识别，脚本改名或新增的节点仍然内联输出
+func applyProxyProviders(yamlStr string, providers []*subscriptionProvider) (string, error) {
+	var config map[string]any
+	err := yaml.Unmarshal([]byte(yamlStr), &config)
+	if err != nil {
+		return "", err
+	}
+
+	inProvider := func(name string) bool {
+		for _, p := range providers {
+			if p.names.Has(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	proxies := make([]any, 0)
+	for _, proxy := range configProxies(config) {
+		if !inProvider(anyToString(proxy["name"])) {
+			proxies = append(proxies, proxy)
+		}
+	}
+	config["proxies"] = proxies
+
+	for _, group := range configGroups(config) {
+		members := groupMembers(group)
+		kept := make([]string, 0, len(members))
+		hits := make([]string, 0)
+		for _, member := range members {
+			if inProvider(member) {
+				hits = append(hits, member)
+			} else {
+				kept = append(kept, member)
+			}
+		}
+		if len(hits) == 0 {
+			continue
+		}
+
+		hitSet := NewSet(hits...)
+		use := anyToStrings(group["use"])
+		partial := false
+		for _, p := range providers {
+			count := 0
+			for name := range p.names {
+				if hitSet.Has(name) {
+					count++
+				}
+			}
+			if count == 0 {
+				continue
+			}
+			use = append(use, p.name)
+			if count < len(p.names) {
+				partial = true
+			}
+		}
+
+		group["use"] = use
+		if partial {
+			group["filter"] = exactNameFilter(hits)
+		}
+		if len(kept) > 0 {
+			group["proxies"] = kept
+		} else {
+			delete(group, "proxies")
+		}
+	}
+
+	proxyProviders, ok := config["proxy-providers"].(map[string]any)
+	if !ok {
+		proxyProviders = make(map[string]any, len(providers))
+	}
+	for _, p := range providers {
+		proxyProviders[p.name] = map[string]any{
+			"type":     "http",
+			"url":      p.url,
+			"path":     fmt.Sprintf("./proxies/%s.yaml", urlHash(p.url)),
+			"interval": ProxyProviderInterval,
+			"health-check": map[string]any{
+				"enable":   true,
+				"url":      HealthCheckUrl,
+				"interval": 300,
+			},
+		}
+	}
+	config["proxy-providers"] = proxyProviders
+
+	return Marshal(config)
+}
+
+// exactNameFilter 生成精确匹配节点名称的 filter，反引号在 filter 中用于分隔多个正则，需要转义
+func exactNameFilter(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, strings.ReplaceAll(regexp.QuoteMeta(name), "`", `\x60`))
+	}
+	return "^(?:" + strings.Join(quoted, "|") + ")$"
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// quanxRuleTypes Clash 规则类型到 Quantumult X filter 类型的映射
+var quanxRuleTypes = map[string]string{
+	"DOMAIN":         "host",
+	"DOMAIN-SUFFIX":  "host-suffix",
+	"DOMAIN-KEYWORD": "host-keyword",
+	"IP-CIDR":        "ip-cidr",
+	"IP-CIDR6":       "ip6-cidr",
+	"IP-ASN":         "ip-asn",
+	"GEOIP":          "geoip",
+	"MATCH":          "final",
+}
+
+// quanxGroupTypes Clash 策略组类型到 Quantumult X 策略类型的映射
+var quanxGroupTypes = map[string]string{
+	"select":       "static",
+	"url-test":     "url-latency-benchmark",
+	"fallback":     "available",
+	"load-balance": "round-robin",
+}
+
+// quanxPolicyName 将内置策略转为 Quantumult X 的小写名称
+func quanxPolicyName(name string) string {
+	switch name {
+	case "DIRECT":
+		return "direct"
+	case "REJECT", "REJECT-DROP":
+		return "reject"
+	default:
+		return confName(name)
+	}
+}
+
+// renderQuantumultX 将 Clash 配置渲染为 Quantumult X 配置
+// 生成 [server_local]、[policy]、[filter_local] 段落并替换模板中的同名段落
+func renderQuantumultX(config map[string]any, template string) (result RenderResult, err error) {
+	valid := NewSet("DIRECT", "REJECT", "REJECT-DROP")
+
+	serverSection := confSection{name: "server_local"}
+	for _, proxy := range configProxies(config) {
+		name := anyToString(proxy["name"])
+		line, ok := quanxProxyLine(proxy, confName(name))
+		if !ok {
+			result.drop("proxy", fmt.Sprintf("%s (%s)", name, anyToString(proxy["type"])))
+			continue
+		}
+		valid[name] = true
+		serverSection.lines = append(serverSection.lines, line)
+	}
+
+	groups := configGroups(config)
+	supported := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		if _, ok := quanxGroupTypes[anyToString(group["type"])]; !ok {
+			result.drop("group", fmt.Sprintf("%s (%s)", anyToString(group["name"]), anyToString(group["type"])))
+			continue
+		}
+		supported = append(supported, group)
+	}
+
+	policySection := confSection{name: "policy"}
+	for _, group := range pruneGroups(supported, valid, &result) {
+		policySection.lines = append(policySection.lines, quanxPolicyLine(group))
+	}
+
+	filterSection := confSection{name: "filter_local"}
+	for _, rule := range configRules(config) {
+		line, ok := quanxFilterLine(rule, valid)
+		if !ok {
+			result.drop("rule", rule)
+			continue
+		}
+		filterSection.lines = append(filterSection.lines, line)
+	}
+
+	result.Body = mergeConfSections(template, []confSection{serverSection, policySection, filterSection}, result.Dropped)
+	return
+}
+
+// quanxProxyLine 生成 [server_local] 节点行
+func quanxProxyLine(proxy map[string]any, name string) (string, bool) {
+	address := fmt.Sprintf("%s:%d", anyToString(proxy["server"]), anyToInt(proxy["port"]))
+	params := confParams{}
+
+	switch anyToString(proxy["type"]) {
+	case "ss":
+		params.add("shadowsocks", address)
+		params.add("method", anyToString(proxy["cipher"]))
+		params.add("password", anyToString(proxy["password"]))
+		pluginOpts, _ := proxy["plugin-opts"].(map[string]any)
+		switch anyToString(proxy["plugin"]) {
+		case "":
+		case "obfs":
+			params.add("obfs", anyToString(pluginOpts["mode"]))
+			params.add("obfs-host", anyToString(pluginOpts["host"]))
+		case "v2ray-plugin":
+			if anyToBool(pluginOpts["tls"]) {
+				params.add("obfs", "wss")
+			} else {
+				params.add("obfs", "ws")
+			}
+			params.add("obfs-host", anyToString(pluginOpts["host"]))
+			params.add("obfs-uri", anyToString(pluginOpts["path"]))
+		default:
+			return "", false
+		}
+		params.add("udp-relay", anyToBool(proxy["udp"]))
+	case "ssr":
+		params.add("shadowsocks", address)
+		params.add("method", anyToString(proxy["cipher"]))
+		params.add("password", anyToString(proxy["password"]))
+		params.add("ssr-protocol", anyToString(proxy["protocol"]))
+		params.add("ssr-protocol-param", anyToString(proxy["protocol-param"]))
+		params.add("obfs", anyToString(proxy["obfs"]))
+		params.add("obfs-host", anyToString(proxy["obfs-param"]))
+	case "vmess":
+		method := anyToString(proxy["cipher"])
+		if method == "" || method == "auto" {
+			method = "chacha20-poly1305"
+		}
+		params.add("vmess", address)
+		params.add("method", method)
+		params.add("password", anyToString(proxy["uuid"]))
+		if !setQuanxObfs(&params, proxy, anyToBool(proxy["tls"])) {
+			return "", false
+		}
+		// QX 默认使用 AEAD，alterId 不为 0 的旧节点需要显式关闭
+		if anyToInt(proxy["alterId"]) > 0 {
+			params.raw("aead=false")
+		}
+	case "vless":
+		params.add("vless", address)
+		params.add("method", "none")
+		params.add("password", anyToString(proxy["uuid"]))
+		if !setQuanxObfs(&params, proxy, anyToBool(proxy["tls"])) {
+			return "", false
+		}
+		params.add("vless-flow", anyToString(proxy["flow"]))
+		if realityOpts, ok := proxy["reality-opts"].(map[string]any); ok {
+			params.add("reality-base64-pubkey", anyToString(realityOpts["public-key"]))
+			params.add("reality-hex-shortid", anyToString(realityOpts["short-id"]))
+		}
+	case "trojan":
+		params.add("trojan", address)
+		params.add("password", anyToString(proxy["password"]))
+		if !setQuanxObfs(&params, proxy, true) {
+			return "", false
+		}
+	case "http", "socks5":
+		params.add(anyToString(proxy["type"]), address)
+		params.add("username", anyToString(proxy["username"]))
+		params.add("password", anyToString(proxy["password"]))
+		params.add("over-tls", anyToBool(proxy["tls"]))
+		setQuanxTls(&params, proxy)
+	default:
+		return "", false
+	}
+
+	params.add("tag", name)
+	return strings.Join(params, ", "), true
+}
+
+// setQuanxObfs 将 network 与 tls 组合为 obfs 参数：ws / wss / over-tls / http
+// trojan 的 tcp + tls 使用 over-tls=true，vmess / vless 使用 obfs=over-tls 并以 obfs-host 作为 SNI
+func setQuanxObfs(params *confParams, proxy map[string]any, tls bool) bool {
+	switch anyToString(proxy["network"]) {
+	case "", "tcp":
+		if !tls {
+			break
+		}
+		if anyToString(proxy["type"]) == "trojan" {
+			params.add("over-tls", true)
+			break
+		}
+		params.add("obfs", "over-tls")
+		params.add("obfs-host", firstNonEmpty(anyToString(proxy["servername"]), anyToString(proxy["sni"])))
+		setQuanxTlsVerification(params, proxy)
+		return true
+	case "ws":
+		wsOpts, _ := proxy["ws-opts"].(map[string]any)
+		headers, _ := wsOpts["headers"].(map[string]any)
+		if tls {
+			params.add("obfs", "wss")
+		} else {
+			params.add("obfs", "ws")
+		}
+		params.add("obfs-host", anyToString(headers["Host"]))
+		params.add("obfs-uri", anyToString(wsOpts["path"]))
+	case "http":
+		if tls {
+			return false
+		}
+		httpOpts, _ := proxy["http-opts"].(map[string]any)
+		headers, _ := httpOpts["headers"].(map[string]any)
+		params.add("obfs", "http")
+		if host := anyToStrings(headers["Host"]); len(host) > 0 {
+			params.add("obfs-host", host[0])
+		}
+		if paths := anyToStrings(httpOpts["path"]); len(paths) > 0 {
+			params.add("obfs-uri", paths[0])
+		}
+	default:
+		return false
+	}
+
+	if tls {
+		setQuanxTls(params, proxy)
+	}
+	return true
+}
+
+// setQuanxTls 设置 tls-host 和 tls-verification
+func setQuanxTls(params *confParams, proxy map[string]any) {
+	params.add("tls-host", firstNonEmpty(anyToString(proxy["servername"]), anyToString(proxy["sni"])))
+	setQuanxTlsVerification(params, proxy)
+}
+
+// setQuanxTlsVerification 跳过证书验证时设置 tls-verification=false
+func setQuanxTlsVerification(params *confParams, proxy map[string]any) {
+	if anyToBool(proxy["skip-cert-verify"]) {
+		params.raw("tls-verification=false")
+	}
+}
+
+// quanxPolicyLine 生成 [policy] 策略行
+func quanxPolicyLine(group map[string]any) string {
+	groupType := anyToString(group["type"])
+	parts := []string{fmt.Sprintf("%s=%s", quanxGroupTypes[groupType], confName(anyToString(group["name"])))}
+	for _, member := range groupMembers(group) {
+		parts = append(parts, quanxPolicyName(member))
+	}
+
+	if groupType == "url-test" || groupType == "fallback" {
+		params := confParams{}
+		params.add("check-interval", firstNonEmpty(anyToString(group["interval"]), "300"))
+		params.add("tolerance", anyToInt(group["tolerance"]))
+		parts = append(parts, params...)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// quanxFilterLine 转换单条规则为 [filter_local] 行，不支持的规则返回 ok=false
+func quanxFilterLine(rule string, valid Set) (line string, ok bool) {
+	ruleType, payload, target, options, ok := splitRule(rule)
+	if !ok || !valid.Has(target) {
+		return "", false
+	}
+
+	filterType, ok := quanxRuleTypes[ruleType]
+	if !ok {
+		return "", false
+	}
+	if code := strings.ToLower(payload); ruleType == "GEOIP" && (code == "lan" || code == "private") {
+		return "", false
+	}
+
+	parts := []string{filterType}
+	if ruleType != "MATCH" {
+		parts = append(parts, payload)
+	}
+	parts = append(parts, quanxPolicyName(target))
+	for _, option := range options {
+		if option == "no-resolve" {
+			parts = append(parts, option)
+		}
+	}
+	return strings.Join(parts, ", "), true
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+)
+
+// RuleOptions 规则末尾支持的附加参数
+var RuleOptions = NewSet("no-resolve", "src")
+
+// GeoIPCodes GEOIP 规则支持的代码：ISO 3166-1 国家和地区代码，以及 geoip 数据库中常见的特殊分类
+var GeoIPCodes = NewSet(strings.Fields(`
+	AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW
+	BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI
+	FJ FK FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM IN
+	IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME
+	MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF
+	PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV
+	SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS XK
+	YE YT ZA ZM ZW
+	LAN PRIVATE CLOUDFLARE CLOUDFRONT FACEBOOK FASTLY GOOGLE NETFLIX TELEGRAM TWITTER TOR
+`)...)
+
+// errUnknownGeoIPCode GEOIP 代码既不在 GeoIPCodes 中也不在 geoip 数据中，规则集中的此类规则会被丢弃而不是报错
+var errUnknownGeoIPCode = errors.New("unknown geoip code")
+
+// knownGeoIPCode 判断 GEOIP 代码是否已知：在 GeoIPCodes 中，或存在于数据目录的 geoip 数据中
+func knownGeoIPCode(code string) bool {
+	if GeoIPCodes.Has(strings.ToUpper(code)) {
+		return true
+	}
+	ips, err := loadGeoip()
+	if err != nil {
+		return false
+	}
+	_, found := ips[strings.ToLower(code)]
+	return found
+}
+
+// RegexRuleTypes payload 为正则的规则类型，正则中可能包含逗号
+var RegexRuleTypes = NewSet("DOMAIN-REGEX", "PROCESS-NAME-REGEX", "PROCESS-PATH-REGEX")
+
+// splitRegexPayload 拆分正则规则 TYPE 之后的部分，parts 为按逗号拆分且未去除空白的各段
+// 末尾的附加参数以及 hasTarget 时其前的 target 之外的部分均属于 payload，例如 ^a{1,3}\.com$,PROXY,no-resolve
+func splitRegexPayload(parts []string, hasTarget bool) (payload string, rest []string) {
+	end := len(parts)
+	for end > 1 && RuleOptions.Has(strings.TrimSpace(parts[end-1])) {
+		end--
+	}
+	if hasTarget && end > 1 {
+		end--
+	}
+	for _, part := range parts[end:] {
+		rest = append(rest, strings.TrimSpace(part))
+	}
+	return strings.TrimSpace(strings.Join(parts[:end], ",")), rest
+}
+
+// Rule 单条规则
+// 规则集中的规则没有 Target，由 BuildTemplate 填入 tag；逻辑规则的 Payload 为包含括号的完整条件
+type Rule struct {
+	Type    string
+	Payload string
+	Target  string
+	Options []string
+}
+
+// ParseRule 解析规则，hasTarget 为 false 时按规则集条目解析：TYPE,PAYLOAD[,OPTIONS]
+// 否则按完整规则解析：TYPE,PAYLOAD,TARGET[,OPTIONS] 或 MATCH,TARGET
+func ParseRule(line string, hasTarget bool) (rule *Rule, err error) {
+	ruleType, _, _ := strings.Cut(line, ",")
+	rule = &Rule{Type: strings.ToUpper(strings.TrimSpace(ruleType))}
+
+	var rest []string
+	if LogicalRuleTypes.Has(rule.Type) {
+		_, rule.Payload, rest, err = splitLogicalRule(line)
+		if err != nil {
+			return nil, err
+		}
+	} else if RegexRuleTypes.Has(rule.Type) {
+		_, body, found := strings.Cut(line, ",")
+		if !found {
+			return nil, fmt.Errorf("rules must have at least 2 components")
+		}
+		rule.Payload, rest = splitRegexPayload(strings.Split(body, ","), hasTarget)
+	} else {
+		parts := strings.Split(line, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		if rule.Type == "MATCH" || rule.Type == "FINAL" {
+			rule.Type = "MATCH"
+			rest = parts[1:]
+		} else {
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("rules must have at least 2 components")
+			}
+			rule.Payload, rest = parts[1], parts[2:]
+		}
+	}
+
+	if hasTarget {
+		if len(rest) == 0 || rest[0] == "" {
+			return nil, fmt.Errorf("rule has no target")
+		}
+		rule.Target, rest = rest[0], rest[1:]
+	}
+	rule.Options = rest
+
+	return
+}
+
+// String 序列化为规则字符串，Target 为空时输出规则集条目格式
+func (r *Rule) String() string {
+	parts := []string{r.Type}
+	if r.Type != "MATCH" {
+		parts = append(parts, r.Payload)
+	}
+	if r.Target != "" {
+		parts = append(parts, r.Target)
+	}
+	parts = append(parts, r.Options...)
+	return strings.Join(parts, ",")
+}
+
+// Validate 校验规则类型、附加参数以及 payload 的格式
+func (r *Rule) Validate() error {
+	if r.Type != "MATCH" && !RuleTypes.Has(r.Type) {
+		return fmt.Errorf("unsupported rule type: %s", r.Type)
+	}
+	for _, option := range r.Options {
+		if !RuleOptions.Has(option) {
+			return fmt.Errorf("unsupported rule option: %s", option)
+		}
+	}
+	if r.Type != "MATCH" && r.Payload == "" {
+		return fmt.Errorf("rule has empty payload")
+	}
+
+	switch r.Type {
+	case "AND", "OR", "NOT", "SUB-RULE":
+		return validateLogicalRule(r.Type, r.Payload)
+	case "IP-CIDR", "IP-CIDR6", "SRC-IP-CIDR", "IP-SUFFIX", "SRC-IP-SUFFIX":
+		if _, err := netip.ParsePrefix(r.Payload); err != nil {
+			return fmt.Errorf("invalid cidr: %s", r.Payload)
+		}
+	case "DST-PORT", "SRC-PORT", "IN-PORT":
+		return validateRanges(r.Payload, 16)
+	case "UID":
+		return validateRanges(r.Payload, 32)
+	case "DOMAIN-REGEX", "PROCESS-NAME-REGEX", "PROCESS-PATH-REGEX":
+		// 与 mihomo 一致使用 regexp2 语法，支持 (?!...) 等
+		if _, err := regexp2.Compile(r.Payload, regexp2.None); err != nil {
+			return fmt.Errorf("invalid regex %s: %w", r.Payload, err)
+		}
+	case "GEOIP", "SRC-GEOIP":
+		if !knownGeoIPCode(r.Payload) {
+			return fmt.Errorf("%w: %s", errUnknownGeoIPCode, r.Payload)
+		}
+	case "IP-ASN", "SRC-IP-ASN":
+		if _, err := strconv.ParseUint(r.Payload, 10, 32); err != nil {
+			return fmt.Errorf("invalid asn: %s", r.Payload)
+		}
+	case "DSCP":
+		if n, err := strconv.Atoi(r.Payload); err != nil || n < 0 || n > 63 {
+			return fmt.Errorf("invalid dscp: %s", r.Payload)
+		}
+	case "NETWORK":
+		if network := strings.ToLower(r.Payload); network != "tcp" && network != "udp" {
+			return fmt.Errorf("invalid network: %s", r.Payload)
+		}
+	}
+	return nil
+}
+
+// validateRanges 校验以 / 分隔的数字或数字范围，例如端口 80/443/8000-9000
+func validateRanges(payload string, bitSize int) error {
+	for _, r := range strings.Split(payload, "/") {
+		from, to, isRange := strings.Cut(r, "-")
+		start, err := strconv.ParseUint(strings.TrimSpace(from), 10, bitSize)
+		if err != nil {
+			return fmt.Errorf("invalid range: %s", payload)
+		}
+		if !isRange {
+			continue
+		}
+		end, err := strconv.ParseUint(strings.TrimSpace(to), 10, bitSize)
+		if err != nil || end < start {
+			return fmt.Errorf("invalid range: %s", payload)
+		}
+	}
+	return nil
+}
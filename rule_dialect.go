@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ruleDialect 规则集方言，描述如何将其它客户端的规则转为 Clash 规则
+type ruleDialect struct {
+	// 规则类型（大写）到 Clash 规则类型的映射，空字符串表示无法转换；未列出的类型按 Clash 规则处理
+	ruleTypes map[string]string
+	// 条目中带有策略（如 Quantumult X 的 host-suffix, a.com, proxy），转换时去掉附加参数以外的部分
+	dropPolicy bool
+	// 转换时直接去掉的附加参数
+	dropOptions Set
+}
+
+// surgeRuleDialect Surge / Loon 规则，Clash 规则是其子集，因此也作为自动判断时的默认方言
+var surgeRuleDialect = &ruleDialect{
+	ruleTypes: map[string]string{
+		"DEST-PORT":       "DST-PORT",
+		"SRC-IP":          "SRC-IP-CIDR",
+		"PROTOCOL":        "NETWORK",
+		"DOMAIN-WILDCARD": "DOMAIN-REGEX",
+		"USER-AGENT":      "",
+		"URL-REGEX":       "",
+		"DOMAIN-SET":      "",
+		"RULE-SET":        "",
+		"SUBNET":          "",
+		"DEVICE-NAME":     "",
+		"CELLULAR-RADIO":  "",
+		"HOSTNAME-TYPE":   "",
+	},
+	dropOptions: NewSet("extended-matching", "pre-matching"),
+}
+
+// quanxRuleDialect Quantumult X 规则，类型不区分大小写，条目中通常带有策略
+var quanxRuleDialect = &ruleDialect{
+	ruleTypes: map[string]string{
+		"HOST":          "DOMAIN",
+		"HOST-SUFFIX":   "DOMAIN-SUFFIX",
+		"HOST-KEYWORD":  "DOMAIN-KEYWORD",
+		"HOST-WILDCARD": "DOMAIN-REGEX",
+		"IP6-CIDR":      "IP-CIDR6",
+		"USER-AGENT":    "",
+		"URL-REGEX":     "",
+	},
+	dropPolicy: true,
+}
+
+// RuleDialects 可以通过 #dialect= 指定的方言，clash 表示不做转换
+var RuleDialects = map[string]*ruleDialect{
+	"clash": nil,
+	"surge": surgeRuleDialect,
+	"loon":  surgeRuleDialect,
+	"quanx": quanxRuleDialect,
+}
+
+// quanxOnlyRuleTypes 只在 Quantumult X 规则中出现的类型，用于自动判断方言
+var quanxOnlyRuleTypes = NewSet("HOST", "HOST-SUFFIX", "HOST-KEYWORD", "HOST-WILDCARD", "IP6-CIDR")
+
+// splitDialectHint 从规则集链接末尾的 #dialect=xxx 片段中提取方言名称
+func splitDialectHint(rulesetUrl string) (cleanUrl string, dialect string) {
+	idx := strings.LastIndex(rulesetUrl, "#")
+	if idx == -1 {
+		return rulesetUrl, ""
+	}
+
+	dialect, found := strings.CutPrefix(rulesetUrl[idx+1:], "dialect=")
+	if !found {
+		return rulesetUrl, ""
+	}
+	return rulesetUrl[:idx], dialect
+}
+
+// selectRuleDialect 选择规则集的方言，未指定时出现 Quantumult X 特有的规则类型则按 Quantumult X 处理，否则按 Surge 处理
+func selectRuleDialect(name string, lines []rulesetLine) (*ruleDialect, error) {
+	if name != "" {
+		dialect, ok := RuleDialects[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported ruleset dialect: %s", name)
+		}
+		return dialect, nil
+	}
+
+	for _, line := range lines {
+		ruleType, _, _ := strings.Cut(line.text, ",")
+		if quanxOnlyRuleTypes.Has(strings.ToUpper(strings.TrimSpace(ruleType))) {
+			return quanxRuleDialect, nil
+		}
+	}
+	return surgeRuleDialect, nil
+}
+
+// translate 将规则转为 Clash 规则，无法转换时返回 ok=false
+// 逻辑规则中的子规则会逐个转换，任一子规则无法转换则整条规则无法转换
+func (d *ruleDialect) translate(line string) (result string, ok bool) {
+	ruleType, _, _ := strings.Cut(line, ",")
+	ruleType = strings.ToUpper(strings.TrimSpace(ruleType))
+
+	if ruleType == "AND" || ruleType == "OR" || ruleType == "NOT" {
+		_, payload, rest, err := splitLogicalRule(line)
+		if err != nil {
+			// 交由后续解析报告格式错误
+			return line, true
+		}
+		conditions, err := splitConditions(payload)
+		if err != nil {
+			return line, true
+		}
+
+		translated := make([]string, 0, len(conditions))
+		for _, condition := range conditions {
+			c, ok := d.translate(condition)
+			if !ok {
+				return "", false
+			}
+			translated = append(translated, "("+c+")")
+		}
+		return strings.Join(append([]string{ruleType, "(" + strings.Join(translated, ",") + ")"}, rest...), ","), true
+	}
+
+	parts := strings.Split(line, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	clashType, known := d.ruleTypes[ruleType]
+	if !known {
+		clashType = ruleType
+	}
+	if clashType == "" {
+		return "", false
+	}
+	if len(parts) < 2 {
+		return line, true
+	}
+
+	payload, options := parts[1], parts[2:]
+	if d.dropPolicy && RegexRuleTypes.Has(clashType) {
+		payload, options, ok = splitPolicyRegex(parts[1:])
+		if !ok {
+			return "", false
+		}
+	}
+
+	switch ruleType {
+	case "PROTOCOL":
+		payload = strings.ToLower(payload)
+		if payload != "tcp" && payload != "udp" {
+			return "", false
+		}
+	case "SRC-IP":
+		if addr, err := netip.ParseAddr(payload); err == nil {
+			payload = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+	case "DOMAIN-WILDCARD", "HOST-WILDCARD":
+		payload = wildcardRegex(payload)
+	}
+
+	result = clashType + "," + payload
+	for _, option := range options {
+		if d.dropOptions.Has(option) || (d.dropPolicy && !RuleOptions.Has(option)) {
+			continue
+		}
+		result += "," + option
+	}
+	return result, true
+}
+
+// splitPolicyRegex 拆分带策略的正则规则，parts 为 TYPE 之后的各段
+// 正则中可能包含逗号，无法从末尾区分策略，因此按括号是否配对合并正则中被拆开的部分；
+// 合并后括号仍不配对或剩余部分多于一个策略时无法确定正则的范围，返回 ok=false
+func splitPolicyRegex(parts []string) (payload string, options []string, ok bool) {
+	end := 1
+	for end < len(parts) && !regexBalanced(strings.Join(parts[:end], ",")) {
+		end++
+	}
+	payload = strings.Join(parts[:end], ",")
+	if !regexBalanced(payload) {
+		return "", nil, false
+	}
+
+	policies := 0
+	for _, option := range parts[end:] {
+		if !RuleOptions.Has(option) {
+			policies++
+		}
+	}
+	if policies > 1 {
+		return "", nil, false
+	}
+	return payload, parts[end:], true
+}
+
+// regexBalanced 判断正则中的 ()、{}、[] 是否配对，忽略转义字符和字符类中的括号
+func regexBalanced(pattern string) bool {
+	depth, inClass := 0, false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			depth--
+		}
+	}
+	return depth == 0 && !inClass
+}
+
+// wildcardRegex 将 * / ? 通配符转为正则，* 匹配任意字符，? 匹配单个字符
+func wildcardRegex(pattern string) string {
+	quoted := regexp.QuoteMeta(strings.ToLower(pattern))
+	quoted = strings.ReplaceAll(quoted, `\*`, `.*`)
+	quoted = strings.ReplaceAll(quoted, `\?`, `.`)
+	return "^" + quoted + "$"
+}
+
+// summarizeDroppedRules 按规则类型统计被丢弃的规则，例如 USER-AGENT x12, URL-REGEX x3
+func summarizeDroppedRules(dropped []DroppedItem) string {
+	counts := make(map[string]int)
+	for _, item := range dropped {
+		ruleType, _, _ := strings.Cut(item.Item, ",")
+		counts[strings.ToUpper(strings.TrimSpace(ruleType))]++
+	}
+
+	types := make([]string, 0, len(counts))
+	for ruleType := range counts {
+		types = append(types, ruleType)
+	}
+	sort.Strings(types)
+
+	parts := make([]string, 0, len(types))
+	for _, ruleType := range types {
+		parts = append(parts, fmt.Sprintf("%s x%d", ruleType, counts[ruleType]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// logDroppedRules 记录规则集中无法转换或不支持的规则
+func logDroppedRules(url string, dropped []DroppedItem) {
+	if len(dropped) == 0 {
+		return
+	}
+	L().Warn(fmt.Sprintf("Ruleset %s: dropped %d rules (%s)", url, len(dropped), summarizeDroppedRules(dropped)))
+}
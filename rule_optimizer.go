@@ -0,0 +1,245 @@
+package main
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// RuleOptimizeStats 规则优化中被移除的规则数量
+type RuleOptimizeStats struct {
+	Duplicate int // 完全重复
+	Shadowed  int // 被前面的规则覆盖，永远不会命中
+	Merged    int // 相邻 CIDR 合并后减少的数量
+}
+
+// Removed 被移除的规则总数
+func (s RuleOptimizeStats) Removed() int {
+	return s.Duplicate + s.Shadowed + s.Merged
+}
+
+// cidrShadowKey 区分 CIDR 规则的匹配方式：是否匹配源地址，是否不解析域名
+type cidrShadowKey struct {
+	src       bool
+	noResolve bool
+}
+
+// ruleShadows 记录已出现的规则所能覆盖的范围，用于判断后面的规则是否永远不会命中
+type ruleShadows struct {
+	seen     Set
+	suffixes Set
+	keywords []string
+	cidrs    map[cidrShadowKey]map[netip.Prefix]bool
+}
+
+// optimizeRules 在保持首条命中语义的前提下精简规则：
+// 移除完全重复的规则；移除被前面的规则覆盖的规则（DOMAIN / DOMAIN-SUFFIX 被更早的 DOMAIN-SUFFIX 或
+// DOMAIN-KEYWORD 覆盖，IP-CIDR 被更早的更大网段覆盖）；合并连续的、target 和附加参数都相同的 CIDR 规则
+func optimizeRules(rules []*Rule) (result []*Rule, stats RuleOptimizeStats) {
+	shadows := &ruleShadows{
+		seen:     NewSet(),
+		suffixes: NewSet(),
+		cidrs:    make(map[cidrShadowKey]map[netip.Prefix]bool),
+	}
+
+	kept := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		key := ruleKey(rule)
+		if shadows.seen.Has(key) {
+			stats.Duplicate++
+			continue
+		}
+		shadows.seen[key] = true
+
+		if shadows.covers(rule) {
+			stats.Shadowed++
+			continue
+		}
+		shadows.add(rule)
+		kept = append(kept, rule)
+	}
+
+	result = mergeAdjacentCidrs(kept)
+	stats.Merged = len(kept) - len(result)
+	return
+}
+
+// ruleKey 规则去掉 target 后的唯一标识，域名和 GEOIP 代码不区分大小写
+func ruleKey(rule *Rule) string {
+	payload := rule.Payload
+	switch rule.Type {
+	case "DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD", "GEOIP", "SRC-GEOIP", "GEOSITE":
+		payload = normalizeDomain(payload)
+	case "IP-CIDR", "IP-CIDR6", "SRC-IP-CIDR":
+		if prefix, err := netip.ParsePrefix(payload); err == nil {
+			payload = prefix.Masked().String()
+		}
+	}
+	return strings.Join(append([]string{rule.Type, payload}, rule.Options...), ",")
+}
+
+// normalizeDomain 域名统一为小写并去掉末尾的点
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
+
+// ruleCidr 读取 IP-CIDR / IP-CIDR6 规则的网段和匹配方式，其它规则返回 ok=false
+func ruleCidr(rule *Rule) (prefix netip.Prefix, key cidrShadowKey, ok bool) {
+	if rule.Type != "IP-CIDR" && rule.Type != "IP-CIDR6" {
+		return
+	}
+	prefix, err := netip.ParsePrefix(rule.Payload)
+	if err != nil {
+		return
+	}
+	key = cidrShadowKey{
+		src:       slices.Contains(rule.Options, "src"),
+		noResolve: slices.Contains(rule.Options, "no-resolve"),
+	}
+	return prefix.Masked(), key, true
+}
+
+// covers 判断规则能命中的请求是否都已被前面的规则命中
+func (s *ruleShadows) covers(rule *Rule) bool {
+	if prefix, key, ok := ruleCidr(rule); ok {
+		// 会解析域名的规则覆盖范围更大，可以覆盖 no-resolve 的规则，反之不行
+		candidates := []cidrShadowKey{{src: key.src, noResolve: false}}
+		if key.noResolve {
+			candidates = append(candidates, key)
+		}
+		for bits := 0; bits <= prefix.Bits(); bits++ {
+			parent := netip.PrefixFrom(prefix.Addr(), bits).Masked()
+			for _, candidate := range candidates {
+				if s.cidrs[candidate][parent] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if len(rule.Options) > 0 {
+		return false
+	}
+
+	switch rule.Type {
+	case "DOMAIN", "DOMAIN-SUFFIX":
+		domain := normalizeDomain(rule.Payload)
+		for suffix := domain; ; {
+			if s.suffixes.Has(suffix) {
+				return true
+			}
+			_, parent, found := strings.Cut(suffix, ".")
+			if !found {
+				break
+			}
+			suffix = parent
+		}
+		return s.containsKeyword(domain)
+	case "DOMAIN-KEYWORD":
+		return s.containsKeyword(normalizeDomain(rule.Payload))
+	}
+	return false
+}
+
+// containsKeyword 判断域名是否包含前面任一 DOMAIN-KEYWORD 规则的关键字
+func (s *ruleShadows) containsKeyword(domain string) bool {
+	for _, keyword := range s.keywords {
+		if strings.Contains(domain, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// add 记录规则的覆盖范围
+func (s *ruleShadows) add(rule *Rule) {
+	if prefix, key, ok := ruleCidr(rule); ok {
+		if s.cidrs[key] == nil {
+			s.cidrs[key] = make(map[netip.Prefix]bool)
+		}
+		s.cidrs[key][prefix] = true
+		return
+	}
+
+	if len(rule.Options) > 0 {
+		return
+	}
+
+	switch rule.Type {
+	case "DOMAIN-SUFFIX":
+		s.suffixes[normalizeDomain(rule.Payload)] = true
+	case "DOMAIN-KEYWORD":
+		s.keywords = append(s.keywords, normalizeDomain(rule.Payload))
+	}
+}
+
+// mergeAdjacentCidrs 合并连续的、target 和附加参数都相同的 CIDR 规则
+// 这些规则命中的结果相同，因此组内的顺序无关紧要
+func mergeAdjacentCidrs(rules []*Rule) []*Rule {
+	result := make([]*Rule, 0, len(rules))
+	for i := 0; i < len(rules); {
+		j := i
+		prefixes := make([]netip.Prefix, 0)
+		for ; j < len(rules); j++ {
+			prefix, _, ok := ruleCidr(rules[j])
+			if !ok || rules[j].Target != rules[i].Target || !slices.Equal(rules[j].Options, rules[i].Options) {
+				break
+			}
+			prefixes = append(prefixes, prefix)
+		}
+
+		if len(prefixes) < 2 {
+			result = append(result, rules[i])
+			i++
+			continue
+		}
+
+		for _, prefix := range aggregatePrefixes(prefixes) {
+			ruleType := "IP-CIDR"
+			if prefix.Addr().Is6() {
+				ruleType = "IP-CIDR6"
+			}
+			result = append(result, &Rule{
+				Type:    ruleType,
+				Payload: prefix.String(),
+				Target:  rules[i].Target,
+				Options: rules[i].Options,
+			})
+		}
+		i = j
+	}
+	return result
+}
+
+// aggregatePrefixes 去掉被包含的网段并合并相邻的同级网段，例如 10.0.0.0/9 和 10.128.0.0/9 合并为 10.0.0.0/8
+func aggregatePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := slices.Clone(prefixes)
+	slices.SortFunc(sorted, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+
+	stack := make([]netip.Prefix, 0, len(sorted))
+	for _, prefix := range sorted {
+		if n := len(stack); n > 0 && stack[n-1].Contains(prefix.Addr()) && stack[n-1].Bits() <= prefix.Bits() {
+			continue
+		}
+		stack = append(stack, prefix)
+
+		for n := len(stack); n >= 2; n = len(stack) {
+			a, b := stack[n-2], stack[n-1]
+			if a.Bits() != b.Bits() || a.Bits() == 0 || a.Addr().Is4() != b.Addr().Is4() {
+				break
+			}
+			parent := netip.PrefixFrom(a.Addr(), a.Bits()-1).Masked()
+			if parent.Addr() != a.Addr() || !parent.Contains(b.Addr()) {
+				break
+			}
+			stack = append(stack[:n-2], parent)
+		}
+	}
+	return stack
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// mihomo 二进制规则集（.mrs）格式：zstd 压缩的
+// magic "MRS\x01" | behavior (1 字节) | count (int64) | extra 长度 (int64) | extra | 规则数据
+// domain 规则数据为简洁字典树（DomainSet），ipcidr 规则数据为合并后的地址范围（IpCidrSet），均以版本号 1 开头
+
+// MrsMagic .mrs 文件头
+var MrsMagic = [4]byte{'M', 'R', 'S', 1}
+
+// zstdMagic zstd 帧头，用于识别下载的内容是否为 .mrs
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// mrsBehaviors .mrs 中的行为编码，mihomo 不支持 classical 行为的 .mrs
+var mrsBehaviors = []string{"domain", "ipcidr"}
+
+// mrsMaxLength 读取时单个数组的最大长度，避免损坏的文件申请过大的内存
+const mrsMaxLength = 1 << 26
+
+// mrsMaxSize 解压后的最大字节数，防止压缩率极高的文件占满内存
+const mrsMaxSize = 1 << 26
+
+// mrsReadChunk 分块读取数组时每块的元素个数，数组按实际读到的数据增长，而不是按声明的长度预先分配
+const mrsReadChunk = 4096
+
+// fetchRuleset 下载规则集，.mrs 文件会被解码为逐行的 domain / ipcidr 条目后再缓存，第一行注释记录其行为
+func fetchRuleset(url string) (string, error) {
+	content, err := FetchBytes(url)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(content, zstdMagic) {
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	behavior, entries, err := decodeMrs(content)
+	if err != nil {
+		return "", fmt.Errorf("ruleset %s: %w", url, err)
+	}
+	return mrsContentPrefix + behavior + "\n" + strings.Join(entries, "\n"), nil
+}
+
+// decodeMrs 解码 .mrs 规则集，domain 行为返回 example.com / +.example.com / .example.com / *.example.com 形式的条目，
+// ipcidr 行为返回 CIDR 条目
+func decodeMrs(data []byte) (behavior string, entries []string, err error) {
+	reader, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	limited := io.LimitReader(reader, mrsMaxSize)
+
+	var header struct {
+		Magic    [4]byte
+		Behavior byte
+		Count    int64
+		Extra    int64
+	}
+	if err = binary.Read(limited, binary.BigEndian, &header); err != nil {
+		return "", nil, fmt.Errorf("invalid mrs header: %w", err)
+	}
+	if header.Magic != MrsMagic {
+		return "", nil, fmt.Errorf("invalid mrs magic")
+	}
+	if int(header.Behavior) >= len(mrsBehaviors) {
+		return "", nil, fmt.Errorf("unsupported mrs behavior: %d", header.Behavior)
+	}
+	if header.Extra < 0 || header.Extra > mrsMaxLength {
+		return "", nil, fmt.Errorf("invalid mrs extra length: %d", header.Extra)
+	}
+	if _, err = io.CopyN(io.Discard, limited, header.Extra); err != nil {
+		return "", nil, fmt.Errorf("invalid mrs extra: %w", err)
+	}
+
+	var version [1]byte
+	if _, err = io.ReadFull(limited, version[:]); err != nil {
+		return "", nil, fmt.Errorf("invalid mrs data: %w", err)
+	}
+	if version[0] != 1 {
+		return "", nil, fmt.Errorf("unsupported mrs data version: %d", version[0])
+	}
+
+	behavior = mrsBehaviors[header.Behavior]
+	if behavior == "domain" {
+		entries, err = readDomainSet(limited)
+	} else {
+		entries, err = readIpCidrSet(limited)
+	}
+	return
+}
+
+// encodeMrs 将整理后的 domain / ipcidr 规则编码为 .mrs 规则集
+// domain 行为只能包含 DOMAIN、DOMAIN-SUFFIX 以及由 * 通配符条目或 . 前缀条目生成的 DOMAIN-REGEX，ipcidr 行为只能包含 IP-CIDR / IP-CIDR6
+func encodeMrs(behavior string, rules []*Rule) ([]byte, error) {
+	behaviorCode := slices.Index(mrsBehaviors, behavior)
+	if behaviorCode == -1 {
+		return nil, fmt.Errorf("mrs only supports domain and ipcidr behaviors, got %q", behavior)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("empty ruleset cannot be encoded as mrs")
+	}
+
+	var body bytes.Buffer
+	body.WriteByte(1)
+	var err error
+	if behavior == "domain" {
+		err = writeDomainSet(&body, rules)
+	} else {
+		err = writeIpCidrSet(&body, rules)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	if err != nil {
+		return nil, err
+	}
+	header := struct {
+		Magic    [4]byte
+		Behavior byte
+		Count    int64
+		Extra    int64
+	}{MrsMagic, byte(behaviorCode), int64(len(rules)), 0}
+	if err = binary.Write(writer, binary.BigEndian, header); err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(body.Bytes()); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readMrsLength 读取数组长度，要求至少一个元素
+func readMrsLength(r io.Reader) (int, error) {
+	var length int64
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return 0, fmt.Errorf("invalid mrs data: %w", err)
+	}
+	if length < 1 || length > mrsMaxLength {
+		return 0, fmt.Errorf("invalid mrs data length: %d", length)
+	}
+	return int(length), nil
+}
+
+// readMrsUint64s 分块读取 length 个 uint64，数据不足时返回错误
+func readMrsUint64s(r io.Reader, length int) ([]uint64, error) {
+	values := make([]uint64, 0, min(length, mrsReadChunk))
+	chunk := make([]uint64, min(length, mrsReadChunk))
+	for len(values) < length {
+		n := min(length-len(values), len(chunk))
+		if err := binary.Read(r, binary.BigEndian, chunk[:n]); err != nil {
+			return nil, fmt.Errorf("invalid mrs data: %w", err)
+		}
+		values = append(values, chunk[:n]...)
+	}
+	return values, nil
+}
+
+// readDomainSet 读取 DomainSet：leaves、labelBitmap 两个 uint64 位图以及 labels
+// 字典树按层序（LOUDS）编码，每个节点的子节点标签对应 labelBitmap 中的 0，节点结束对应 1，键为反转后的域名
+func readDomainSet(r io.Reader) (entries []string, err error) {
+	arrays := make([][]uint64, 2)
+	for i := range arrays {
+		var length int
+		if length, err = readMrsLength(r); err != nil {
+			return
+		}
+		if arrays[i], err = readMrsUint64s(r, length); err != nil {
+			return
+		}
+	}
+	leaves, labelBitmap := arrays[0], arrays[1]
+
+	length, err := readMrsLength(r)
+	if err != nil {
+		return
+	}
+	var labelBuf bytes.Buffer
+	if _, err = io.CopyN(&labelBuf, r, int64(length)); err != nil {
+		return nil, fmt.Errorf("invalid mrs data: %w", err)
+	}
+	labels := labelBuf.Bytes()
+
+	// 第 i 个标签对应第 i+1 个节点，记录每个节点的父节点
+	parents := make([]int, len(labels)+1)
+	nodeId, labelIdx := 0, 0
+	for bmIdx := 0; nodeId <= len(labels); bmIdx++ {
+		if bmIdx >= len(labelBitmap)*64 {
+			return nil, fmt.Errorf("invalid mrs domain set: truncated label bitmap")
+		}
+		if getBit(labelBitmap, bmIdx) {
+			nodeId++
+			continue
+		}
+		if labelIdx >= len(labels) {
+			return nil, fmt.Errorf("invalid mrs domain set: too many labels")
+		}
+		labelIdx++
+		parents[labelIdx] = nodeId
+	}
+
+	keys := make([]string, 0)
+	for node := 1; node <= len(labels); node++ {
+		if !getBit(leaves, node) {
+			continue
+		}
+		// 从叶子回溯到根得到的正是未反转的域名
+		var key []byte
+		for n := node; n != 0; n = parents[n] {
+			key = append(key, labels[n-1])
+		}
+		keys = append(keys, string(key))
+	}
+
+	// DomainSet 中 +.example.com 只匹配子域名，与 example.com 同时存在时才等价于 +.example.com 条目，读取时合并；
+	// 单独存在时等价于 .example.com 条目
+	keySet := NewSet(keys...)
+	entries = make([]string, 0, len(keys))
+	for _, key := range keys {
+		if suffix, found := strings.CutPrefix(key, "+."); found {
+			if keySet.Has(suffix) {
+				entries = append(entries, key)
+			} else {
+				entries = append(entries, key[1:])
+			}
+			continue
+		}
+		if !keySet.Has("+." + key) {
+			entries = append(entries, key)
+		}
+	}
+	return
+}
+
+// writeDomainSet 将域名规则写为 DomainSet
+func writeDomainSet(w io.Writer, rules []*Rule) error {
+	keySet := NewSet()
+	for _, rule := range rules {
+		if len(rule.Options) > 0 {
+			return fmt.Errorf("rule cannot be encoded as mrs: %s", rule.String())
+		}
+		domain := normalizeDomain(rule.Payload)
+		switch rule.Type {
+		case "DOMAIN":
+			keySet[domain] = true
+		case "DOMAIN-SUFFIX":
+			keySet[domain] = true
+			keySet["+."+domain] = true
+		case "DOMAIN-REGEX":
+			entry, ok := wildcardDomainEntry(rule.Payload)
+			if !ok {
+				return fmt.Errorf("rule cannot be encoded as mrs: %s", rule.String())
+			}
+			if strings.HasPrefix(entry, ".") {
+				// 只匹配子域名的 .example.com 在 DomainSet 中为不带 example.com 的 +.example.com
+				entry = "+" + entry
+			}
+			keySet[entry] = true
+		default:
+			return fmt.Errorf("rule cannot be encoded as mrs: %s", rule.String())
+		}
+	}
+
+	// 键按反转后的字典序排列，保证相同前缀连续且较短的键在前
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, reverseString(key))
+	}
+	slices.Sort(keys)
+
+	var leaves, labelBitmap []uint64
+	var labels []byte
+	type queueItem struct{ start, end, col int }
+	queue := []queueItem{{0, len(keys), 0}}
+	bmIdx := 0
+	for i := 0; i < len(queue); i++ {
+		item := queue[i]
+		if item.col == len(keys[item.start]) {
+			item.start++
+			setBit(&leaves, i)
+		}
+		for j := item.start; j < item.end; {
+			from := j
+			for ; j < item.end && keys[j][item.col] == keys[from][item.col]; j++ {
+			}
+			queue = append(queue, queueItem{from, j, item.col + 1})
+			labels = append(labels, keys[from][item.col])
+			bmIdx++
+		}
+		setBit(&labelBitmap, bmIdx)
+		bmIdx++
+	}
+
+	for _, array := range [][]uint64{leaves, labelBitmap} {
+		if err := binary.Write(w, binary.BigEndian, int64(len(array))); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, array); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(w, binary.BigEndian, int64(len(labels))); err != nil {
+		return err
+	}
+	_, err := w.Write(labels)
+	return err
+}
+
+// wildcardDomainEntry 还原由 * 通配符条目或 . 前缀条目生成的 DOMAIN-REGEX，
+// 例如 ^[^.]+\.example\.com$ 还原为 *.example.com，^.+\.example\.com$ 还原为 .example.com
+func wildcardDomainEntry(pattern string) (string, bool) {
+	entry, found := strings.CutPrefix(pattern, "^")
+	if !found {
+		return "", false
+	}
+	entry, found = strings.CutSuffix(entry, "$")
+	if !found {
+		return "", false
+	}
+	entry = strings.TrimPrefix(entry, ".+")
+	entry = strings.ReplaceAll(entry, `[^.]+`, "*")
+	entry = strings.NewReplacer(`\.`, ".", `\+`, "+").Replace(entry)
+
+	rule, err := domainEntryRule(entry)
+	if err != nil || rule != "DOMAIN-REGEX,"+pattern {
+		return "", false
+	}
+	return strings.ToLower(entry), true
+}
+
+// readIpCidrSet 读取 IpCidrSet：按顺序排列的 [起始地址, 结束地址] 范围，地址均为 16 字节
+func readIpCidrSet(r io.Reader) (entries []string, err error) {
+	length, err := readMrsLength(r)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < length; i++ {
+		var pair [2][16]byte
+		if err = binary.Read(r, binary.BigEndian, &pair); err != nil {
+			return nil, fmt.Errorf("invalid mrs data: %w", err)
+		}
+		from := netip.AddrFrom16(pair[0]).Unmap()
+		to := netip.AddrFrom16(pair[1]).Unmap()
+		if from.Is4() != to.Is4() || from.Compare(to) > 0 {
+			return nil, fmt.Errorf("invalid mrs ip range: %s-%s", from, to)
+		}
+		for _, prefix := range rangePrefixes(from, to) {
+			entries = append(entries, prefix.String())
+		}
+	}
+	return
+}
+
+// writeIpCidrSet 将 CIDR 规则合并为地址范围后写为 IpCidrSet
+func writeIpCidrSet(w io.Writer, rules []*Rule) error {
+	type ipRange struct{ from, to netip.Addr }
+	ranges := make([]ipRange, 0, len(rules))
+	for _, rule := range rules {
+		prefix, _, ok := ruleCidr(rule)
+		if !ok || len(rule.Options) > 0 {
+			return fmt.Errorf("rule cannot be encoded as mrs: %s", rule.String())
+		}
+		ranges = append(ranges, ipRange{prefix.Addr(), prefixLastAddr(prefix)})
+	}
+	slices.SortFunc(ranges, func(a, b ipRange) int {
+		return a.from.Compare(b.from)
+	})
+
+	// 合并重叠或相邻的范围，IPv4 与 IPv6 不合并
+	merged := make([]ipRange, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && merged[n-1].to.Is4() == r.from.Is4() {
+			last := &merged[n-1]
+			if next := last.to.Next(); !next.IsValid() || next.Compare(r.from) >= 0 {
+				if r.to.Compare(last.to) > 0 {
+					last.to = r.to
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	if err := binary.Write(w, binary.BigEndian, int64(len(merged))); err != nil {
+		return err
+	}
+	for _, r := range merged {
+		if err := binary.Write(w, binary.BigEndian, [2][16]byte{r.from.As16(), r.to.As16()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefixLastAddr 网段中的最后一个地址
+func prefixLastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr()
+	a16 := addr.As16()
+	offset := 128 - addr.BitLen()
+	for bit := offset + prefix.Bits(); bit < 128; bit++ {
+		a16[bit/8] |= 0x80 >> (bit % 8)
+	}
+	return netip.AddrFrom16(a16).Unmap()
+}
+
+// rangePrefixes 将地址范围拆分为最少的网段
+func rangePrefixes(from netip.Addr, to netip.Addr) (prefixes []netip.Prefix) {
+	for {
+		bits := from.BitLen()
+		for bits > 0 {
+			prefix := netip.PrefixFrom(from, bits-1)
+			if prefix.Masked().Addr() != from || prefixLastAddr(prefix).Compare(to) > 0 {
+				break
+			}
+			bits--
+		}
+
+		prefix := netip.PrefixFrom(from, bits)
+		prefixes = append(prefixes, prefix)
+		last := prefixLastAddr(prefix)
+		if last.Compare(to) >= 0 {
+			return
+		}
+		from = last.Next()
+	}
+}
+
+// setBit 将位图的第 i 位置为 1，位图长度不足时自动扩展
+func setBit(bm *[]uint64, i int) {
+	for i>>6 >= len(*bm) {
+		*bm = append(*bm, 0)
+	}
+	(*bm)[i>>6] |= 1 << uint(i&63)
+}
+
+// getBit 读取位图的第 i 位，超出长度视为 0
+func getBit(bm []uint64, i int) bool {
+	if i>>6 >= len(bm) {
+		return false
+	}
+	return bm[i>>6]&(1<<uint(i&63)) != 0
+}
+
+// reverseString 按字节反转字符串，域名只包含 ASCII 字符
+func reverseString(s string) string {
+	b := []byte(s)
+	slices.Reverse(b)
+	return string(b)
+}
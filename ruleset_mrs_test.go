@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// mrsDomainSet 测试用的 DomainSet，has 按 mihomo component/trie/domain_set.go 的 Has 实现匹配
+type mrsDomainSet struct {
+	leaves, labelBitmap []uint64
+	labels              []byte
+}
+
+func readTestDomainSet(t *testing.T, data []byte) *mrsDomainSet {
+	t.Helper()
+	r := bytes.NewReader(data)
+	ss := &mrsDomainSet{}
+	for _, array := range []*[]uint64{&ss.leaves, &ss.labelBitmap} {
+		var length int64
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			t.Fatal(err)
+		}
+		*array = make([]uint64, length)
+		if err := binary.Read(r, binary.BigEndian, *array); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var length int64
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		t.Fatal(err)
+	}
+	ss.labels = make([]byte, length)
+	if _, err := r.Read(ss.labels); err != nil {
+		t.Fatal(err)
+	}
+	return ss
+}
+
+// countZeros 位图 [0, i) 中 0 的个数
+func (ss *mrsDomainSet) countZeros(i int) int {
+	n := 0
+	for j := 0; j < i; j++ {
+		if !getBit(ss.labelBitmap, j) {
+			n++
+		}
+	}
+	return n
+}
+
+// selectIthOne 位图中第 i 个（从 0 开始）1 的位置
+func (ss *mrsDomainSet) selectIthOne(i int) int {
+	for j := 0; j < len(ss.labelBitmap)*64; j++ {
+		if getBit(ss.labelBitmap, j) {
+			if i == 0 {
+				return j
+			}
+			i--
+		}
+	}
+	return -1
+}
+
+func (ss *mrsDomainSet) has(key string) bool {
+	key = reverseString(strings.ToLower(key))
+	nodeId, bmIdx := 0, 0
+	type wildcardCursor struct{ bmIdx, index int }
+	stack := make([]wildcardCursor, 0)
+	for i := 0; i < len(key); i++ {
+	RESTART:
+		c := key[i]
+		for ; ; bmIdx++ {
+			if getBit(ss.labelBitmap, bmIdx) {
+				if len(stack) > 0 {
+					cursor := stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+					nextNodeId := ss.countZeros(cursor.bmIdx + 1)
+					nextBmIdx := ss.selectIthOne(nextNodeId-1) + 1
+					j := cursor.index
+					for ; j < len(key) && key[j] != '.'; j++ {
+					}
+					if j == len(key) {
+						if getBit(ss.leaves, nextNodeId) {
+							return true
+						}
+						goto RESTART
+					}
+					for ; nextBmIdx-nextNodeId < len(ss.labels); nextBmIdx++ {
+						if ss.labels[nextBmIdx-nextNodeId] == '.' {
+							bmIdx = nextBmIdx
+							nodeId = nextNodeId
+							i = j
+							goto RESTART
+						}
+					}
+				}
+				return false
+			}
+			label := ss.labels[bmIdx-nodeId]
+			if label == '+' {
+				return true
+			} else if label == '*' {
+				stack = append(stack, wildcardCursor{bmIdx, i})
+			} else if label == c {
+				break
+			}
+		}
+		nodeId = ss.countZeros(bmIdx + 1)
+		bmIdx = ss.selectIthOne(nodeId-1) + 1
+	}
+	return getBit(ss.leaves, nodeId)
+}
+
+func domainEntryRules(t *testing.T, entries ...string) []*Rule {
+	t.Helper()
+	rules, _, err := normalizeRuleset(strings.Join(entries, "\n"), "domain", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func TestWriteDomainSetMatching(t *testing.T) {
+	rules := domainEntryRules(t, ".example.com", "+.a.com", "*.b.com", "c.com")
+	var buf bytes.Buffer
+	if err := writeDomainSet(&buf, rules); err != nil {
+		t.Fatal(err)
+	}
+	ss := readTestDomainSet(t, buf.Bytes())
+
+	cases := map[string]bool{
+		"example.com":     false,
+		"a.example.com":   true,
+		"x.y.example.com": true,
+		"badexample.com":  false,
+		"a.com":           true,
+		"x.a.com":         true,
+		"b.com":           false,
+		"x.b.com":         true,
+		"c.com":           true,
+		"x.c.com":         false,
+	}
+	for domain, want := range cases {
+		if got := ss.has(domain); got != want {
+			t.Errorf("has(%q) = %v, want %v", domain, got, want)
+		}
+	}
+}
+
+func TestDomainSetSubdomainOnlyRoundTrip(t *testing.T) {
+	rules := domainEntryRules(t, ".example.com", "+.a.com", "c.com")
+	var buf bytes.Buffer
+	if err := writeDomainSet(&buf, rules); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readDomainSet(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(entries)
+	want := []string{"+.a.com", ".example.com", "c.com"}
+	if !slices.Equal(entries, want) {
+		t.Errorf("entries = %v, want %v", entries, want)
+	}
+}
+
+func TestMrsDomainRoundTrip(t *testing.T) {
+	entries := []string{"+.a.com", ".example.com", "*.b.com", "c.com", "d.c.com", "+.e.org"}
+	data, err := encodeMrs("domain", domainEntryRules(t, entries...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	behavior, decoded, err := decodeMrs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if behavior != "domain" {
+		t.Errorf("behavior = %q, want domain", behavior)
+	}
+	slices.Sort(entries)
+	slices.Sort(decoded)
+	if !slices.Equal(decoded, entries) {
+		t.Errorf("entries = %v, want %v", decoded, entries)
+	}
+}
+
+func TestMrsIpCidrRoundTrip(t *testing.T) {
+	content := "10.0.0.0/8\n192.168.0.0/24\n192.168.1.0/24\n1.1.1.1\n2001:db8::/32\n::1"
+	rules, _, err := normalizeRuleset(content, "ipcidr", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encodeMrs("ipcidr", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	behavior, decoded, err := decodeMrs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if behavior != "ipcidr" {
+		t.Errorf("behavior = %q, want ipcidr", behavior)
+	}
+	// 相邻的 192.168.0.0/24 与 192.168.1.0/24 合并为一个范围
+	want := []string{"1.1.1.1/32", "10.0.0.0/8", "192.168.0.0/23", "2001:db8::/32", "::1/128"}
+	slices.Sort(decoded)
+	slices.Sort(want)
+	if !slices.Equal(decoded, want) {
+		t.Errorf("entries = %v, want %v", decoded, want)
+	}
+}
+
+func TestReadDomainSetDeclaredLengthExceedsData(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int64(mrsMaxLength))
+	binary.Write(&buf, binary.BigEndian, uint64(1))
+	if _, err := readDomainSet(&buf); err == nil {
+		t.Fatal("expected error for truncated domain set")
+	}
+}
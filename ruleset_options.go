@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// RulesetOptions r(tag, url, options) 中的规则集选项
+type RulesetOptions struct {
+	// 规则集文件格式：list（逐行）、yaml（payload:）、domain、ipcidr、mrs，省略时按内容自动判断
+	Format string `json:"format,omitempty"`
+	// 为 IP 类规则追加 no-resolve，rule-providers 模式下追加在 RULE-SET 规则上
+	NoResolve bool `json:"noResolve,omitempty"`
+	// 缓存时间（秒），省略时使用 CACHE_EXPIRE_SEC
+	Ttl int64 `json:"ttl,omitempty"`
+	// 只保留 / 排除这些类型的规则
+	IncludeTypes []string `json:"includeTypes,omitempty"`
+	ExcludeTypes []string `json:"excludeTypes,omitempty"`
+	// 下载或解析失败时跳过该规则集，而不是让整个请求失败
+	Optional bool `json:"optional,omitempty"`
+}
+
+// RulesetSourceFormats RulesetOptions.Format 支持的格式
+var RulesetSourceFormats = NewSet("", "list", "yaml", "domain", "ipcidr", "mrs")
+
+// noResolveRuleTypes 会触发 DNS 解析、可以追加 no-resolve 的规则类型
+var noResolveRuleTypes = NewSet("IP-CIDR", "IP-CIDR6", "IP-SUFFIX", "IP-ASN", "GEOIP")
+
+// mrsContentPrefix fetchRuleset 解码 .mrs 后写在内容第一行的注释，记录其行为
+const mrsContentPrefix = "# mrs: "
+
+// parseRulesetOptions 解析 r() 的第三个参数：字符串为 behavior，对象为 RulesetOptions
+func parseRulesetOptions(value goja.Value) (behavior string, options RulesetOptions, err error) {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return
+	}
+	if s, ok := value.Export().(string); ok {
+		return s, options, nil
+	}
+
+	raw, err := json.Marshal(value.Export())
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&options); err != nil {
+		return "", options, fmt.Errorf("invalid ruleset options: %w", err)
+	}
+
+	if !RulesetSourceFormats.Has(options.Format) {
+		return "", options, fmt.Errorf("unsupported ruleset format: %s", options.Format)
+	}
+	if options.Ttl < 0 {
+		return "", options, fmt.Errorf("invalid ruleset ttl: %d", options.Ttl)
+	}
+	for _, types := range [][]string{options.IncludeTypes, options.ExcludeTypes} {
+		for i := range types {
+			types[i] = strings.ToUpper(strings.TrimSpace(types[i]))
+			if !RuleTypes.Has(types[i]) {
+				return "", options, fmt.Errorf("unsupported rule type in ruleset options: %s", types[i])
+			}
+		}
+	}
+
+	if options.Format == "domain" || options.Format == "ipcidr" {
+		behavior = options.Format
+	}
+	return
+}
+
+// IsZero 是否未设置任何选项
+func (o RulesetOptions) IsZero() bool {
+	return o.Format == "" && !o.NoResolve && o.Ttl == 0 &&
+		len(o.IncludeTypes) == 0 && len(o.ExcludeTypes) == 0 && !o.Optional
+}
+
+// String 序列化为 JSON，未设置选项时为空字符串，用于持久化和计算 hash
+func (o RulesetOptions) String() string {
+	if o.IsZero() {
+		return ""
+	}
+	raw, _ := json.Marshal(o)
+	return string(raw)
+}
+
+// expire 规则集的缓存时间
+func (o RulesetOptions) expire() time.Duration {
+	if o.Ttl > 0 {
+		return time.Duration(o.Ttl) * time.Second
+	}
+	return CacheExpire
+}
+
+// checkFormat 校验规则集内容是否符合声明的格式，返回由格式或 .mrs 内容确定的行为
+func (o RulesetOptions) checkFormat(content string) (behavior string, err error) {
+	mrsBehavior := ""
+	if first, _, _ := strings.Cut(content, "\n"); strings.HasPrefix(first, mrsContentPrefix) {
+		mrsBehavior = strings.TrimSpace(strings.TrimPrefix(first, mrsContentPrefix))
+	}
+	isYaml := rulesetPayloadPattern.MatchString(content)
+
+	switch o.Format {
+	case "list":
+		if isYaml || mrsBehavior != "" {
+			return "", fmt.Errorf("ruleset is not a list")
+		}
+	case "yaml":
+		if !isYaml {
+			return "", fmt.Errorf("ruleset is not a yaml payload")
+		}
+	case "mrs":
+		if mrsBehavior == "" {
+			return "", fmt.Errorf("ruleset is not mrs")
+		}
+	case "domain", "ipcidr":
+		if mrsBehavior != "" && mrsBehavior != o.Format {
+			return "", fmt.Errorf("ruleset is %s mrs, not %s", mrsBehavior, o.Format)
+		}
+		return o.Format, nil
+	}
+	return mrsBehavior, nil
+}
+
+// apply 按 includeTypes / excludeTypes 过滤规则，noResolve 为 true 时为 IP 类规则追加 no-resolve
+func (o RulesetOptions) apply(rules []*Rule, noResolve bool) []*Rule {
+	result := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		if len(o.IncludeTypes) > 0 && !slices.Contains(o.IncludeTypes, rule.Type) {
+			continue
+		}
+		if slices.Contains(o.ExcludeTypes, rule.Type) {
+			continue
+		}
+		if noResolve && noResolveRuleTypes.Has(rule.Type) && !slices.Contains(rule.Options, "no-resolve") {
+			rule.Options = append(rule.Options, "no-resolve")
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
+// normalize 按选项校验格式并整理规则集内容，r() 声明的 behavior 优先于格式推断的行为
+// noResolve 为 false 时不追加 no-resolve，供 rule-providers 模式在 RULE-SET 规则上追加
+func (r *Ruleset) normalize(noResolve bool) (rules []*Rule, dropped []DroppedItem, err error) {
+	behavior, err := r.options.checkFormat(r.content)
+	if err != nil {
+		return
+	}
+	if r.behavior != "" {
+		behavior = r.behavior
+	}
+
+	_, dialect := splitDialectHint(r.url)
+	rules, dropped, err = normalizeRuleset(r.content, behavior, dialect)
+	if err != nil {
+		return
+	}
+	return r.options.apply(rules, noResolve && r.options.NoResolve), dropped, nil
+}
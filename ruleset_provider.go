@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// RuleProviderInterval 生成的 rule-providers 的更新间隔（秒）
+const RuleProviderInterval = 86400
+
+// rulesetNamePattern 规则集名称中允许的字符
+var rulesetNamePattern = regexp.MustCompile(`[^\w\-.]+`)
+
+// urlHash 根据地址计算短 hash，用于 /ruleset/:hash 以及 provider 的本地缓存路径
+func urlHash(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RegisterRuleset 记录 hash 与规则集地址、行为、选项的对应关系
+// 未声明行为和选项时 hash 只由地址决定，否则同一地址的不同行为、选项对应不同的 hash
+func RegisterRuleset(url string, behavior string, options RulesetOptions) (hash string, err error) {
+	key := url
+	if behavior != "" {
+		key += "#behavior=" + behavior
+	}
+	if !options.IsZero() {
+		key += "#options=" + options.String()
+	}
+	hash = urlHash(key)
+
+	var ref RulesetRef
+	err = orm.First(&ref, "hash = ?", hash).Error
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+
+	err = orm.Create(&RulesetRef{Hash: hash, Url: url, Behavior: behavior, Options: options.String()}).Error
+	return
+}
+
+// FindRuleset 查询 hash 对应的规则集
+func FindRuleset(hash string) (ruleset *Ruleset, err error) {
+	var ref RulesetRef
+	err = orm.First(&ref, "hash = ?", hash).Error
+	if err != nil {
+		return
+	}
+
+	ruleset = &Ruleset{url: ref.Url, behavior: ref.Behavior}
+	if ref.Options != "" {
+		err = json.Unmarshal([]byte(ref.Options), &ruleset.options)
+	}
+	return
+}
+
+// rulesetProviderName 以规则集文件名和 hash 前缀生成可读的 provider 名称
+func rulesetProviderName(url string, hash string) string {
+	base := path.Base(strings.SplitN(url, "?", 2)[0])
+	base = strings.TrimSuffix(base, path.Ext(base))
+	base = strings.Trim(rulesetNamePattern.ReplaceAllString(base, "_"), "_")
+	if base == "" {
+		return hash[:8]
+	}
+	return base + "-" + hash[:8]
+}
+
+// buildRuleProviders 为每个规则集生成 rule-providers 条目，并按顺序生成 RULE-SET 规则
+// format 为 mrs 时，声明了 domain / ipcidr 行为的规则集以该行为和 .mrs 格式引用，其余规则集仍为 classical 的 YAML
+// 选项中的 noResolve 追加在 RULE-SET 规则上
+func buildRuleProviders(ruleLines []*Ruleset, baseUrl string, format string) (providers map[string]any, rules []string, err error) {
+	providers = make(map[string]any, len(ruleLines))
+	rules = make([]string, 0, len(ruleLines))
+
+	for _, ruleset := range ruleLines {
+		var hash string
+		hash, err = RegisterRuleset(ruleset.url, ruleset.behavior, ruleset.options)
+		if err != nil {
+			return
+		}
+
+		name := rulesetProviderName(ruleset.url, hash)
+		provider := map[string]any{
+			"type":     "http",
+			"behavior": "classical",
+			"format":   "yaml",
+			"url":      fmt.Sprintf("%s/ruleset/%s", baseUrl, hash),
+			"path":     fmt.Sprintf("./ruleset/%s.yaml", hash),
+			"interval": RuleProviderInterval,
+		}
+		if format == "mrs" && slices.Contains(mrsBehaviors, ruleset.behavior) {
+			provider["behavior"] = ruleset.behavior
+			provider["format"] = "mrs"
+			provider["url"] = fmt.Sprintf("%s/ruleset/%s?format=mrs", baseUrl, hash)
+			provider["path"] = fmt.Sprintf("./ruleset/%s.mrs", hash)
+		}
+		providers[name] = provider
+
+		rule := fmt.Sprintf("RULE-SET,%s,%s", name, ruleset.tag)
+		if ruleset.options.NoResolve {
+			rule += ",no-resolve"
+		}
+		rules = append(rules, rule)
+	}
+
+	return
+}
+
+// RulesetFormats /ruleset/:hash 支持的输出格式，空字符串等同于 yaml
+var RulesetFormats = NewSet("", "yaml", "mrs")
+
+// RenderRuleset 下载（或读取缓存）并整理规则集，domain / ipcidr 条目会被转为规则，格式检查、规则类型过滤和缓存时间按规则集选项处理
+// format 为 yaml 时统一输出为 classical 行为的 payload YAML；为 mrs 时按 behavior 编码为 domain / ipcidr 的 .mrs
+func RenderRuleset(ruleset *Ruleset, format string) ([]byte, error) {
+	if !RulesetFormats.Has(format) {
+		return nil, fmt.Errorf("unsupported ruleset format: %s", format)
+	}
+
+	cleanUrl, _ := splitDialectHint(ruleset.url)
+	content, err := GetOrPutWithExpire(cleanUrl, ruleset.options.expire(), fetchRuleset)
+	if err != nil {
+		return nil, err
+	}
+	ruleset.content = content
+
+	rules, dropped, err := ruleset.normalize(false)
+	if err != nil {
+		return nil, fmt.Errorf("ruleset %s: %w", ruleset.url, err)
+	}
+	logDroppedRules(ruleset.url, dropped)
+
+	if format == "mrs" {
+		result, e := encodeMrs(ruleset.behavior, rules)
+		if e != nil {
+			return nil, fmt.Errorf("ruleset %s: %w", ruleset.url, e)
+		}
+		return result, nil
+	}
+
+	payload := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		payload = append(payload, rule.String())
+	}
+	result, err := Marshal(map[string]any{"payload": payload})
+	return []byte(result), err
+}
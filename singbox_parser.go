@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SingBoxSkipTypes 不是代理节点的 sing-box outbound 类型
+var SingBoxSkipTypes = NewSet(
+	"selector", "urltest", "direct", "block", "dns",
+)
+
+// isSingBoxConfig 判断内容是否为包含 outbounds 的 sing-box JSON 配置
+func isSingBoxConfig(body string) bool {
+	body = strings.TrimSpace(body)
+	if !strings.HasPrefix(body, "{") {
+		return false
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &config); err != nil {
+		return false
+	}
+	_, hasOutbounds := config["outbounds"]
+	_, hasEndpoints := config["endpoints"]
+	return hasOutbounds || hasEndpoints
+}
+
+// parseSingBoxConfig 将 sing-box 配置中的 outbounds / endpoints 转换为 Clash 节点
+// 分组、直连、拦截等非代理类型会被跳过
+func parseSingBoxConfig(body string) (proxies []map[string]any, err error) {
+	var config struct {
+		Outbounds []map[string]any `json:"outbounds"`
+		Endpoints []map[string]any `json:"endpoints"`
+	}
+	err = json.Unmarshal([]byte(body), &config)
+	if err != nil {
+		return
+	}
+
+	names := NewSet()
+	proxies = make([]map[string]any, 0, len(config.Outbounds))
+	for _, outbound := range append(config.Outbounds, config.Endpoints...) {
+		outboundType := anyToString(outbound["type"])
+		if SingBoxSkipTypes.Has(outboundType) {
+			continue
+		}
+
+		proxy, e := convertSingBoxOutbound(outbound)
+		if e != nil {
+			L().Warn(fmt.Sprintf("Skip sing-box outbound: %s", e.Error()))
+			continue
+		}
+
+		proxy["name"] = uniqueName(names, proxy["name"].(string))
+		proxies = append(proxies, proxy)
+	}
+
+	if len(proxies) == 0 {
+		err = fmt.Errorf("no supported outbound found in sing-box config")
+	}
+
+	return
+}
+
+// anyToInt 将 JSON 中可能为数字或字符串的字段统一转为整数
+func anyToInt(v any) int {
+	i, _ := strconv.Atoi(anyToString(v))
+	return i
+}
+
+// anyToStrings 将 JSON 中的字符串或字符串数组统一转为字符串切片
+func anyToStrings(v any) []string {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case []string:
+		return value
+	case []any:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			result = append(result, anyToString(item))
+		}
+		return result
+	default:
+		return []string{anyToString(value)}
+	}
+}
+
+// convertSingBoxOutbound 转换单个 sing-box outbound
+func convertSingBoxOutbound(outbound map[string]any) (map[string]any, error) {
+	outboundType := anyToString(outbound["type"])
+	server := anyToString(outbound["server"])
+	port := anyToInt(outbound["server_port"])
+
+	name := anyToString(outbound["tag"])
+	if name == "" {
+		name = fmt.Sprintf("%s:%d", server, port)
+	}
+
+	proxy := map[string]any{
+		"name":   name,
+		"server": server,
+		"port":   port,
+	}
+
+	tls, _ := outbound["tls"].(map[string]any)
+	transport, _ := outbound["transport"].(map[string]any)
+
+	switch outboundType {
+	case "shadowsocks":
+		proxy["type"] = "ss"
+		proxy["cipher"] = anyToString(outbound["method"])
+		proxy["password"] = anyToString(outbound["password"])
+		proxy["udp"] = true
+		if plugin := anyToString(outbound["plugin"]); plugin != "" {
+			setShadowsocksPlugin(proxy, plugin+";"+anyToString(outbound["plugin_opts"]))
+		}
+		if uot, ok := outbound["udp_over_tcp"].(bool); ok && uot {
+			proxy["udp-over-tcp"] = true
+		}
+	case "vmess":
+		proxy["type"] = "vmess"
+		proxy["uuid"] = anyToString(outbound["uuid"])
+		proxy["alterId"] = anyToInt(outbound["alter_id"])
+		proxy["cipher"] = firstNonEmpty(anyToString(outbound["security"]), "auto")
+		proxy["udp"] = true
+		setSingBoxTls(proxy, tls, "servername")
+		setSingBoxTransport(proxy, transport)
+	case "vless":
+		proxy["type"] = "vless"
+		proxy["uuid"] = anyToString(outbound["uuid"])
+		proxy["udp"] = true
+		if flow := anyToString(outbound["flow"]); flow != "" {
+			proxy["flow"] = flow
+		}
+		setSingBoxTls(proxy, tls, "servername")
+		setSingBoxTransport(proxy, transport)
+	case "trojan":
+		proxy["type"] = "trojan"
+		proxy["password"] = anyToString(outbound["password"])
+		proxy["udp"] = true
+		setSingBoxTls(proxy, tls, "sni")
+		setSingBoxTransport(proxy, transport)
+	case "hysteria":
+		proxy["type"] = "hysteria"
+		if auth := anyToString(outbound["auth_str"]); auth != "" {
+			proxy["auth-str"] = auth
+		}
+		if obfs := anyToString(outbound["obfs"]); obfs != "" {
+			proxy["obfs"] = obfs
+		}
+		setSingBoxBandwidth(proxy, outbound)
+		setSingBoxServerPorts(proxy, outbound)
+		setSingBoxTls(proxy, tls, "sni")
+	case "hysteria2":
+		proxy["type"] = "hysteria2"
+		proxy["password"] = anyToString(outbound["password"])
+		if obfs, ok := outbound["obfs"].(map[string]any); ok {
+			proxy["obfs"] = anyToString(obfs["type"])
+			proxy["obfs-password"] = anyToString(obfs["password"])
+		}
+		setSingBoxBandwidth(proxy, outbound)
+		setSingBoxServerPorts(proxy, outbound)
+		setSingBoxTls(proxy, tls, "sni")
+	case "tuic":
+		proxy["type"] = "tuic"
+		proxy["uuid"] = anyToString(outbound["uuid"])
+		proxy["password"] = anyToString(outbound["password"])
+		proxy["udp"] = true
+		if cc := anyToString(outbound["congestion_control"]); cc != "" {
+			proxy["congestion-controller"] = cc
+		}
+		if mode := anyToString(outbound["udp_relay_mode"]); mode != "" {
+			proxy["udp-relay-mode"] = mode
+		}
+		if zeroRtt, ok := outbound["zero_rtt_handshake"].(bool); ok && zeroRtt {
+			proxy["reduce-rtt"] = true
+		}
+		setSingBoxTls(proxy, tls, "sni")
+	case "wireguard":
+		return convertSingBoxWireGuard(outbound, proxy)
+	default:
+		return nil, fmt.Errorf("unsupported outbound type: %s", outboundType)
+	}
+
+	return proxy, nil
+}
+
+// convertSingBoxWireGuard 转换 wireguard outbound（旧版）或 endpoint（1.11+）
+func convertSingBoxWireGuard(outbound map[string]any, proxy map[string]any) (map[string]any, error) {
+	proxy["type"] = "wireguard"
+	proxy["private-key"] = anyToString(outbound["private_key"])
+	proxy["udp"] = true
+
+	address := firstNonEmpty(
+		strings.Join(anyToStrings(outbound["local_address"]), ","),
+		strings.Join(anyToStrings(outbound["address"]), ","),
+	)
+	setWireGuardAddress(proxy, address)
+
+	peer := outbound
+	if peers, ok := outbound["peers"].([]any); ok && len(peers) > 0 {
+		peer, _ = peers[0].(map[string]any)
+		if peer == nil {
+			return nil, fmt.Errorf("invalid wireguard peer: %s", proxy["name"])
+		}
+		proxy["server"] = anyToString(peer["address"])
+		proxy["port"] = anyToInt(peer["port"])
+		if allowedIps := anyToStrings(peer["allowed_ips"]); len(allowedIps) > 0 {
+			proxy["allowed-ips"] = allowedIps
+		}
+	}
+
+	proxy["public-key"] = firstNonEmpty(anyToString(peer["peer_public_key"]), anyToString(peer["public_key"]))
+	if psk := anyToString(peer["pre_shared_key"]); psk != "" {
+		proxy["pre-shared-key"] = psk
+	}
+	if reserved, ok := peer["reserved"].([]any); ok && len(reserved) == 3 {
+		proxy["reserved"] = []int{anyToInt(reserved[0]), anyToInt(reserved[1]), anyToInt(reserved[2])}
+	}
+	if mtu := anyToInt(outbound["mtu"]); mtu > 0 {
+		proxy["mtu"] = mtu
+	}
+
+	return proxy, nil
+}
+
+// setSingBoxTls 映射 sing-box 的 tls 块，包括 utls 指纹和 reality
+// sniKey 因协议而异：vmess/vless 为 servername，其余为 sni
+func setSingBoxTls(proxy map[string]any, tls map[string]any, sniKey string) {
+	if tls == nil {
+		return
+	}
+	if enabled, _ := tls["enabled"].(bool); !enabled {
+		return
+	}
+
+	if proxy["type"] == "vmess" || proxy["type"] == "vless" {
+		proxy["tls"] = true
+	}
+	if sni := anyToString(tls["server_name"]); sni != "" {
+		proxy[sniKey] = sni
+	}
+	if insecure, _ := tls["insecure"].(bool); insecure {
+		proxy["skip-cert-verify"] = true
+	}
+	if alpn := anyToStrings(tls["alpn"]); len(alpn) > 0 {
+		proxy["alpn"] = alpn
+	}
+	if utls, ok := tls["utls"].(map[string]any); ok {
+		if enabled, _ := utls["enabled"].(bool); enabled {
+			proxy["client-fingerprint"] = firstNonEmpty(anyToString(utls["fingerprint"]), "chrome")
+		}
+	}
+	if reality, ok := tls["reality"].(map[string]any); ok {
+		if enabled, _ := reality["enabled"].(bool); enabled {
+			realityOpts := map[string]any{
+				"public-key": anyToString(reality["public_key"]),
+			}
+			if sid := anyToString(reality["short_id"]); sid != "" {
+				realityOpts["short-id"] = sid
+			}
+			proxy["reality-opts"] = realityOpts
+		}
+	}
+}
+
+// setSingBoxTransport 映射 sing-box 的 transport 块
+func setSingBoxTransport(proxy map[string]any, transport map[string]any) {
+	if transport == nil {
+		return
+	}
+
+	transportType := anyToString(transport["type"])
+	host := strings.Join(anyToStrings(transport["host"]), ",")
+	if headers, ok := transport["headers"].(map[string]any); ok && host == "" {
+		host = strings.Join(anyToStrings(headers["Host"]), ",")
+	}
+	path := firstNonEmpty(anyToString(transport["path"]), anyToString(transport["service_name"]))
+
+	setTransport(proxy, transportType, "", host, path)
+
+	if wsOpts, ok := proxy["ws-opts"].(map[string]any); ok {
+		if maxEarlyData := anyToInt(transport["max_early_data"]); maxEarlyData > 0 {
+			wsOpts["max-early-data"] = maxEarlyData
+			wsOpts["early-data-header-name"] = anyToString(transport["early_data_header_name"])
+		}
+	}
+}
+
+// setSingBoxBandwidth 映射 up_mbps / down_mbps
+func setSingBoxBandwidth(proxy map[string]any, outbound map[string]any) {
+	if up := anyToInt(outbound["up_mbps"]); up > 0 {
+		proxy["up"] = fmt.Sprintf("%d Mbps", up)
+	}
+	if down := anyToInt(outbound["down_mbps"]); down > 0 {
+		proxy["down"] = fmt.Sprintf("%d Mbps", down)
+	}
+}
+
+// setSingBoxServerPorts 映射端口跳跃 server_ports，例如 ["1000:2000"] -> 1000-2000
+func setSingBoxServerPorts(proxy map[string]any, outbound map[string]any) {
+	ports := anyToStrings(outbound["server_ports"])
+	if len(ports) == 0 {
+		return
+	}
+
+	for i, p := range ports {
+		ports[i] = strings.ReplaceAll(p, ":", "-")
+	}
+	proxy["ports"] = strings.Join(ports, ",")
+}
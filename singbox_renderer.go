@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// singBoxRuleFields Clash 规则类型到 sing-box 路由规则字段的映射
+var singBoxRuleFields = map[string]string{
+	"DOMAIN":             "domain",
+	"DOMAIN-SUFFIX":      "domain_suffix",
+	"DOMAIN-KEYWORD":     "domain_keyword",
+	"DOMAIN-REGEX":       "domain_regex",
+	"IP-CIDR":            "ip_cidr",
+	"IP-CIDR6":           "ip_cidr",
+	"SRC-IP-CIDR":        "source_ip_cidr",
+	"PROCESS-NAME":       "process_name",
+	"PROCESS-PATH":       "process_path",
+	"PROCESS-PATH-REGEX": "process_path_regex",
+	"NETWORK":            "network",
+	"UID":                "user_id",
+	"DST-PORT":           "port",
+	"SRC-PORT":           "source_port",
+}
+
+const (
+	singBoxGeositeUrl = "https://raw.githubusercontent.com/SagerNet/sing-geosite/rule-set/geosite-%s.srs"
+	singBoxGeoipUrl   = "https://raw.githubusercontent.com/SagerNet/sing-geoip/rule-set/geoip-%s.srs"
+)
+
+// anyToBool 读取布尔字段
+func anyToBool(v any) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// renderSingBox 将 Clash 配置渲染为 sing-box 配置
+// 节点转为 outbounds（wireguard 转为 endpoints），策略组转为 selector / urltest，规则转为 route.rules
+func renderSingBox(config map[string]any, template string) (result RenderResult, err error) {
+	base := make(map[string]any)
+	if template != "" {
+		err = json.Unmarshal([]byte(template), &base)
+		if err != nil {
+			err = fmt.Errorf("invalid sing-box template: %s", err.Error())
+			return
+		}
+	}
+
+	outbounds, _ := base["outbounds"].([]any)
+	endpoints, _ := base["endpoints"].([]any)
+	// sing-box 1.12 起 block 出站已弃用，REJECT 只作为路由规则的 reject 动作，策略组中的 REJECT 会被移除
+	valid := NewSet("DIRECT")
+
+	proxyOutbounds := make([]any, 0)
+	for _, proxy := range configProxies(config) {
+		name := anyToString(proxy["name"])
+		outbound, ok := convertProxyToSingBox(proxy)
+		if !ok {
+			result.drop("proxy", fmt.Sprintf("%s (%s)", name, anyToString(proxy["type"])))
+			continue
+		}
+
+		valid[name] = true
+		if outbound["type"] == "wireguard" {
+			endpoints = append(endpoints, outbound)
+		} else {
+			proxyOutbounds = append(proxyOutbounds, outbound)
+		}
+	}
+
+	groups := pruneGroups(configGroups(config), valid, &result)
+	for _, group := range groups {
+		outbounds = append(outbounds, convertGroupToSingBox(group, &result))
+	}
+	outbounds = append(outbounds, proxyOutbounds...)
+	outbounds = append(outbounds, map[string]any{"type": "direct", "tag": "DIRECT"})
+
+	base["outbounds"] = outbounds
+	if len(endpoints) > 0 {
+		base["endpoints"] = endpoints
+	}
+
+	route, _ := base["route"].(map[string]any)
+	if route == nil {
+		route = make(map[string]any)
+	}
+	convertRulesToSingBox(configRules(config), valid, route, &result)
+	base["route"] = route
+
+	body, err := json.MarshalIndent(base, "", "  ")
+	if err != nil {
+		return
+	}
+	result.Body = string(body)
+
+	return
+}
+
+// convertProxyToSingBox 将 Clash 节点转换为 sing-box outbound
+func convertProxyToSingBox(proxy map[string]any) (outbound map[string]any, ok bool) {
+	outbound = map[string]any{
+		"tag":         anyToString(proxy["name"]),
+		"server":      anyToString(proxy["server"]),
+		"server_port": anyToInt(proxy["port"]),
+	}
+
+	switch anyToString(proxy["type"]) {
+	case "ss":
+		outbound["type"] = "shadowsocks"
+		outbound["method"] = anyToString(proxy["cipher"])
+		outbound["password"] = anyToString(proxy["password"])
+		if anyToBool(proxy["udp-over-tcp"]) {
+			outbound["udp_over_tcp"] = true
+		}
+		if plugin, opts := singBoxPlugin(proxy); plugin != "" {
+			outbound["plugin"] = plugin
+			outbound["plugin_opts"] = opts
+		}
+	case "vmess":
+		outbound["type"] = "vmess"
+		outbound["uuid"] = anyToString(proxy["uuid"])
+		outbound["alter_id"] = anyToInt(proxy["alterId"])
+		outbound["security"] = firstNonEmpty(anyToString(proxy["cipher"]), "auto")
+		setSingBoxOutboundTls(outbound, proxy, anyToBool(proxy["tls"]))
+		setSingBoxOutboundTransport(outbound, proxy)
+	case "vless":
+		outbound["type"] = "vless"
+		outbound["uuid"] = anyToString(proxy["uuid"])
+		if flow := anyToString(proxy["flow"]); flow != "" {
+			outbound["flow"] = flow
+		}
+		setSingBoxOutboundTls(outbound, proxy, anyToBool(proxy["tls"]))
+		setSingBoxOutboundTransport(outbound, proxy)
+	case "trojan":
+		outbound["type"] = "trojan"
+		outbound["password"] = anyToString(proxy["password"])
+		setSingBoxOutboundTls(outbound, proxy, true)
+		setSingBoxOutboundTransport(outbound, proxy)
+	case "hysteria":
+		outbound["type"] = "hysteria"
+		outbound["auth_str"] = anyToString(proxy["auth-str"])
+		if obfs := anyToString(proxy["obfs"]); obfs != "" {
+			outbound["obfs"] = obfs
+		}
+		setSingBoxOutboundBandwidth(outbound, proxy)
+		setSingBoxOutboundPorts(outbound, proxy)
+		setSingBoxOutboundTls(outbound, proxy, true)
+	case "hysteria2":
+		outbound["type"] = "hysteria2"
+		outbound["password"] = anyToString(proxy["password"])
+		if obfs := anyToString(proxy["obfs"]); obfs != "" {
+			outbound["obfs"] = map[string]any{
+				"type":     obfs,
+				"password": anyToString(proxy["obfs-password"]),
+			}
+		}
+		setSingBoxOutboundBandwidth(outbound, proxy)
+		setSingBoxOutboundPorts(outbound, proxy)
+		setSingBoxOutboundTls(outbound, proxy, true)
+	case "tuic":
+		if anyToString(proxy["token"]) != "" {
+			// sing-box 仅支持 TUIC v5
+			return nil, false
+		}
+		outbound["type"] = "tuic"
+		outbound["uuid"] = anyToString(proxy["uuid"])
+		outbound["password"] = anyToString(proxy["password"])
+		if cc := anyToString(proxy["congestion-controller"]); cc != "" {
+			outbound["congestion_control"] = cc
+		}
+		if mode := anyToString(proxy["udp-relay-mode"]); mode != "" {
+			outbound["udp_relay_mode"] = mode
+		}
+		if anyToBool(proxy["reduce-rtt"]) {
+			outbound["zero_rtt_handshake"] = true
+		}
+		setSingBoxOutboundTls(outbound, proxy, true)
+	case "wireguard":
+		outbound = convertWireGuardToSingBox(proxy)
+	case "http":
+		outbound["type"] = "http"
+		setSingBoxOutboundAuth(outbound, proxy)
+		setSingBoxOutboundTls(outbound, proxy, anyToBool(proxy["tls"]))
+	case "socks5":
+		outbound["type"] = "socks"
+		setSingBoxOutboundAuth(outbound, proxy)
+	default:
+		return nil, false
+	}
+
+	return outbound, true
+}
+
+// convertWireGuardToSingBox 将 wireguard 节点转换为 sing-box 1.11+ 的 endpoint
+func convertWireGuardToSingBox(proxy map[string]any) map[string]any {
+	address := make([]string, 0, 2)
+	if ip := anyToString(proxy["ip"]); ip != "" {
+		address = append(address, ip+"/32")
+	}
+	if ipv6 := anyToString(proxy["ipv6"]); ipv6 != "" {
+		address = append(address, ipv6+"/128")
+	}
+
+	allowedIps := anyToStrings(proxy["allowed-ips"])
+	if len(allowedIps) == 0 {
+		allowedIps = []string{"0.0.0.0/0", "::/0"}
+	}
+
+	peer := map[string]any{
+		"address":     anyToString(proxy["server"]),
+		"port":        anyToInt(proxy["port"]),
+		"public_key":  anyToString(proxy["public-key"]),
+		"allowed_ips": allowedIps,
+	}
+	if psk := anyToString(proxy["pre-shared-key"]); psk != "" {
+		peer["pre_shared_key"] = psk
+	}
+	if reserved, ok := proxy["reserved"].([]any); ok {
+		peer["reserved"] = reserved
+	}
+
+	endpoint := map[string]any{
+		"type":        "wireguard",
+		"tag":         anyToString(proxy["name"]),
+		"address":     address,
+		"private_key": anyToString(proxy["private-key"]),
+		"peers":       []any{peer},
+	}
+	if mtu := anyToInt(proxy["mtu"]); mtu > 0 {
+		endpoint["mtu"] = mtu
+	}
+	return endpoint
+}
+
+// singBoxPlugin 将 Clash 的 plugin / plugin-opts 转换为 SIP003 插件参数
+func singBoxPlugin(proxy map[string]any) (plugin string, opts string) {
+	pluginOpts, _ := proxy["plugin-opts"].(map[string]any)
+	switch anyToString(proxy["plugin"]) {
+	case "obfs":
+		plugin = "obfs-local"
+		opts = fmt.Sprintf("obfs=%s;obfs-host=%s", anyToString(pluginOpts["mode"]), anyToString(pluginOpts["host"]))
+	case "v2ray-plugin":
+		plugin = "v2ray-plugin"
+		parts := []string{"mode=" + firstNonEmpty(anyToString(pluginOpts["mode"]), "websocket")}
+		if anyToBool(pluginOpts["tls"]) {
+			parts = append(parts, "tls")
+		}
+		if host := anyToString(pluginOpts["host"]); host != "" {
+			parts = append(parts, "host="+host)
+		}
+		if path := anyToString(pluginOpts["path"]); path != "" {
+			parts = append(parts, "path="+path)
+		}
+		opts = strings.Join(parts, ";")
+	}
+	return
+}
+
+// setSingBoxOutboundTls 设置 tls 块，包括 utls 指纹和 reality
+func setSingBoxOutboundTls(outbound map[string]any, proxy map[string]any, enabled bool) {
+	if !enabled {
+		return
+	}
+
+	tls := map[string]any{
+		"enabled": true,
+	}
+	if sni := firstNonEmpty(anyToString(proxy["servername"]), anyToString(proxy["sni"])); sni != "" {
+		tls["server_name"] = sni
+	}
+	if anyToBool(proxy["skip-cert-verify"]) {
+		tls["insecure"] = true
+	}
+	if alpn := anyToStrings(proxy["alpn"]); len(alpn) > 0 {
+		tls["alpn"] = alpn
+	}
+	if fingerprint := anyToString(proxy["client-fingerprint"]); fingerprint != "" {
+		tls["utls"] = map[string]any{
+			"enabled":     true,
+			"fingerprint": fingerprint,
+		}
+	}
+	if realityOpts, ok := proxy["reality-opts"].(map[string]any); ok {
+		tls["reality"] = map[string]any{
+			"enabled":    true,
+			"public_key": anyToString(realityOpts["public-key"]),
+			"short_id":   anyToString(realityOpts["short-id"]),
+		}
+	}
+	outbound["tls"] = tls
+}
+
+// setSingBoxOutboundTransport 将 network 及对应 opts 转换为 transport 块
+func setSingBoxOutboundTransport(outbound map[string]any, proxy map[string]any) {
+	switch anyToString(proxy["network"]) {
+	case "ws":
+		wsOpts, _ := proxy["ws-opts"].(map[string]any)
+		transport := map[string]any{
+			"type": "ws",
+			"path": firstNonEmpty(anyToString(wsOpts["path"]), "/"),
+		}
+		if anyToBool(wsOpts["v2ray-http-upgrade"]) {
+			transport["type"] = "httpupgrade"
+		}
+		if headers, ok := wsOpts["headers"].(map[string]any); ok {
+			if transport["type"] == "httpupgrade" {
+				transport["host"] = anyToString(headers["Host"])
+			} else {
+				transport["headers"] = headers
+			}
+		}
+		if maxEarlyData := anyToInt(wsOpts["max-early-data"]); maxEarlyData > 0 {
+			transport["max_early_data"] = maxEarlyData
+			transport["early_data_header_name"] = anyToString(wsOpts["early-data-header-name"])
+		}
+		outbound["transport"] = transport
+	case "grpc":
+		grpcOpts, _ := proxy["grpc-opts"].(map[string]any)
+		outbound["transport"] = map[string]any{
+			"type":         "grpc",
+			"service_name": anyToString(grpcOpts["grpc-service-name"]),
+		}
+	case "h2":
+		h2Opts, _ := proxy["h2-opts"].(map[string]any)
+		transport := map[string]any{
+			"type": "http",
+		}
+		if host := anyToStrings(h2Opts["host"]); len(host) > 0 {
+			transport["host"] = host
+		}
+		if path := anyToString(h2Opts["path"]); path != "" {
+			transport["path"] = path
+		}
+		outbound["transport"] = transport
+	case "http":
+		httpOpts, _ := proxy["http-opts"].(map[string]any)
+		transport := map[string]any{
+			"type":   "http",
+			"method": firstNonEmpty(anyToString(httpOpts["method"]), "GET"),
+		}
+		if paths := anyToStrings(httpOpts["path"]); len(paths) > 0 {
+			transport["path"] = paths[0]
+		}
+		if headers, ok := httpOpts["headers"].(map[string]any); ok {
+			if host := anyToStrings(headers["Host"]); len(host) > 0 {
+				transport["host"] = host
+			}
+		}
+		outbound["transport"] = transport
+	}
+}
+
+// setSingBoxOutboundBandwidth 将 up / down 转换为 up_mbps / down_mbps
+func setSingBoxOutboundBandwidth(outbound map[string]any, proxy map[string]any) {
+	if up := parseMbps(proxy["up"]); up > 0 {
+		outbound["up_mbps"] = up
+	}
+	if down := parseMbps(proxy["down"]); down > 0 {
+		outbound["down_mbps"] = down
+	}
+}
+
+// setSingBoxOutboundPorts 将端口跳跃 ports 转换为 server_ports，例如 1000-2000 -> 1000:2000
+func setSingBoxOutboundPorts(outbound map[string]any, proxy map[string]any) {
+	ports := anyToString(proxy["ports"])
+	if ports == "" {
+		return
+	}
+
+	serverPorts := make([]string, 0)
+	for _, p := range splitList(ports) {
+		if strings.Contains(p, "-") {
+			serverPorts = append(serverPorts, strings.ReplaceAll(p, "-", ":"))
+		}
+	}
+	if len(serverPorts) > 0 {
+		outbound["server_ports"] = serverPorts
+	}
+}
+
+// setSingBoxOutboundAuth 设置 http / socks 的用户名和密码
+func setSingBoxOutboundAuth(outbound map[string]any, proxy map[string]any) {
+	if username := anyToString(proxy["username"]); username != "" {
+		outbound["username"] = username
+		outbound["password"] = anyToString(proxy["password"])
+	}
+}
+
+// convertGroupToSingBox 将策略组转换为 selector 或 urltest
+// fallback / load-balance 没有对应类型，以 urltest 近似
+func convertGroupToSingBox(group map[string]any, result *RenderResult) map[string]any {
+	name := anyToString(group["name"])
+	outbound := map[string]any{
+		"tag":       name,
+		"outbounds": groupMembers(group),
+	}
+
+	switch groupType := anyToString(group["type"]); groupType {
+	case "url-test", "fallback", "load-balance":
+		outbound["type"] = "urltest"
+		if url := anyToString(group["url"]); url != "" {
+			outbound["url"] = url
+		}
+		if interval := anyToInt(group["interval"]); interval > 0 {
+			outbound["interval"] = fmt.Sprintf("%ds", interval)
+		}
+		if tolerance := anyToInt(group["tolerance"]); tolerance > 0 {
+			outbound["tolerance"] = tolerance
+		}
+		if groupType != "url-test" {
+			L().Warn(fmt.Sprintf("Group %s (%s) rendered as urltest", name, groupType))
+		}
+	case "select":
+		outbound["type"] = "selector"
+	default:
+		result.drop("group type", fmt.Sprintf("%s (%s) rendered as selector", name, groupType))
+		outbound["type"] = "selector"
+	}
+
+	return outbound
+}
+
+// convertRulesToSingBox 将规则转换为 route.rules，连续的同类型同目标规则会合并为一条
+// MATCH 转为 route.final，REJECT 转为 reject 动作，GEOIP / GEOSITE 转为远程 rule_set
+func convertRulesToSingBox(rules []string, valid Set, route map[string]any, result *RenderResult) {
+	routeRules, _ := route["rules"].([]any)
+	ruleSets, _ := route["rule_set"].([]any)
+	ruleSetTags := NewSet()
+	for _, ruleSet := range ruleSets {
+		if rs, ok := ruleSet.(map[string]any); ok {
+			ruleSetTags[anyToString(rs["tag"])] = true
+		}
+	}
+
+	var last map[string]any
+	var lastKey string
+
+	for _, rule := range rules {
+		ruleType, payload, target, _, ok := splitRule(rule)
+		if !ok {
+			result.drop("rule", rule)
+			continue
+		}
+
+		if target != "REJECT" && target != "REJECT-DROP" && !valid.Has(target) {
+			result.drop("rule", rule)
+			continue
+		}
+
+		if ruleType == "MATCH" {
+			if valid.Has(target) {
+				route["final"] = target
+			} else {
+				// 不含匹配条件的规则匹配所有连接
+				routeRules = append(routeRules, singBoxRejectRule(map[string]any{}, target))
+				last = nil
+			}
+			continue
+		}
+
+		field, value := "", any(payload)
+		switch ruleType {
+		case "GEOIP":
+			code := strings.ToLower(payload)
+			if code == "lan" || code == "private" {
+				field, value = "ip_is_private", true
+				break
+			}
+			field, value = "rule_set", "geoip-"+code
+			addSingBoxRuleSet(&ruleSets, ruleSetTags, "geoip-"+code, fmt.Sprintf(singBoxGeoipUrl, code))
+		case "GEOSITE":
+			code := strings.ToLower(payload)
+			field, value = "rule_set", "geosite-"+code
+			addSingBoxRuleSet(&ruleSets, ruleSetTags, "geosite-"+code, fmt.Sprintf(singBoxGeositeUrl, code))
+		case "DST-PORT", "SRC-PORT":
+			field = singBoxRuleFields[ruleType]
+			if strings.ContainsAny(payload, "-:") {
+				field += "_range"
+				value = strings.ReplaceAll(payload, "-", ":")
+			} else if port, e := strconv.Atoi(payload); e == nil {
+				value = port
+			}
+		case "NETWORK":
+			field, value = "network", strings.ToLower(payload)
+		case "UID":
+			uid, e := strconv.Atoi(payload)
+			if e != nil {
+				result.drop("rule", rule)
+				continue
+			}
+			field, value = "user_id", uid
+		default:
+			field = singBoxRuleFields[ruleType]
+		}
+
+		if field == "" {
+			result.drop("rule", rule)
+			continue
+		}
+
+		key := field + "\x00" + target
+		if _, isBool := value.(bool); !isBool && last != nil && key == lastKey {
+			last[field] = append(last[field].([]any), value)
+			continue
+		}
+
+		routeRule := make(map[string]any)
+		if isBool, _ := value.(bool); isBool {
+			routeRule[field] = true
+		} else {
+			routeRule[field] = []any{value}
+		}
+		if target == "REJECT" || target == "REJECT-DROP" {
+			singBoxRejectRule(routeRule, target)
+		} else {
+			routeRule["outbound"] = target
+		}
+
+		routeRules = append(routeRules, routeRule)
+		last, lastKey = routeRule, key
+	}
+
+	route["rules"] = routeRules
+	if len(ruleSets) > 0 {
+		route["rule_set"] = ruleSets
+	}
+}
+
+// singBoxRejectRule 为路由规则设置 reject 动作，REJECT-DROP 使用 drop 方式
+func singBoxRejectRule(routeRule map[string]any, target string) map[string]any {
+	routeRule["action"] = "reject"
+	if target == "REJECT-DROP" {
+		routeRule["method"] = "drop"
+	}
+	return routeRule
+}
+
+// addSingBoxRuleSet 添加远程 rule_set，已存在时跳过
+func addSingBoxRuleSet(ruleSets *[]any, tags Set, tag string, url string) {
+	if tags.Has(tag) {
+		return
+	}
+	tags[tag] = true
+	*ruleSets = append(*ruleSets, map[string]any{
+		"type":   "remote",
+		"tag":    tag,
+		"format": "binary",
+		"url":    url,
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// sip008Config Shadowsocks SIP008 在线配置
+// https://shadowsocks.org/doc/sip008.html
+type sip008Config struct {
+	Version        int            `json:"version"`
+	Servers        []sip008Server `json:"servers"`
+	BytesUsed      int64          `json:"bytes_used"`
+	BytesRemaining int64          `json:"bytes_remaining"`
+}
+
+type sip008Server struct {
+	Id         string `json:"id"`
+	Remarks    string `json:"remarks"`
+	Server     string `json:"server"`
+	ServerPort int    `json:"server_port"`
+	Password   string `json:"password"`
+	Method     string `json:"method"`
+	Plugin     string `json:"plugin"`
+	PluginOpts string `json:"plugin_opts"`
+}
+
+// isSip008Config 判断内容是否为 SIP008 JSON
+func isSip008Config(body string) bool {
+	body = strings.TrimSpace(body)
+	if !strings.HasPrefix(body, "{") {
+		return false
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &config); err != nil {
+		return false
+	}
+	_, hasVersion := config["version"]
+	_, hasServers := config["servers"]
+	return hasVersion && hasServers
+}
+
+// parseSip008Config 解析 SIP008 JSON
+// bytes_used / bytes_remaining 映射为订阅用量，用于 Sub Info 展示
+func parseSip008Config(body string, meta *SubscriptionMeta) (proxies []map[string]any, err error) {
+	var config sip008Config
+	err = json.Unmarshal([]byte(body), &config)
+	if err != nil {
+		return
+	}
+
+	if config.Version != 1 {
+		err = fmt.Errorf("unsupported SIP008 version: %d", config.Version)
+		return
+	}
+
+	names := NewSet()
+	proxies = make([]map[string]any, 0, len(config.Servers))
+	for _, server := range config.Servers {
+		name := firstNonEmpty(server.Remarks, fmt.Sprintf("%s:%d", server.Server, server.ServerPort))
+		proxy := map[string]any{
+			"name":     uniqueName(names, name),
+			"type":     "ss",
+			"server":   server.Server,
+			"port":     server.ServerPort,
+			"cipher":   server.Method,
+			"password": server.Password,
+			"udp":      true,
+		}
+		if server.Plugin != "" {
+			setShadowsocksPlugin(proxy, server.Plugin+";"+server.PluginOpts)
+		}
+		proxies = append(proxies, proxy)
+	}
+
+	if config.BytesUsed > 0 || config.BytesRemaining > 0 {
+		meta.Download = config.BytesUsed
+		meta.Total = config.BytesUsed + config.BytesRemaining
+	}
+
+	return
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"resty.dev/v3"
+)
+
+// SubscriptionResponse 订阅源的响应，统一远程与本地订阅
+type SubscriptionResponse struct {
+	StatusCode int
+	Body       string
+	Header     http.Header
+}
+
+// fetchSubscription 获取订阅内容
+// 支持 http(s)://、file:（限定在 LocalSubDir 内）和 data: URI
+func fetchSubscription(subUrl string) (res SubscriptionResponse, err error) {
+	switch {
+	case strings.HasPrefix(subUrl, "file:"):
+		return readLocalSubscription(strings.TrimPrefix(subUrl, "file:"))
+	case strings.HasPrefix(subUrl, "data:"):
+		return decodeDataUri(subUrl)
+	default:
+		return fetchRemoteSubscription(subUrl)
+	}
+}
+
+// subscriptionLogUrl 返回用于日志的订阅地址，data: URI 中包含节点凭据，只记录 scheme 和长度
+func subscriptionLogUrl(subUrl string) string {
+	if strings.HasPrefix(subUrl, "data:") {
+		return fmt.Sprintf("data: (%d bytes)", len(subUrl))
+	}
+	return subUrl
+}
+
+// isRemoteUrl 是否为 http(s) 地址
+func isRemoteUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// fetchRemoteSubscription 通过 HTTP 获取订阅
+func fetchRemoteSubscription(subUrl string) (res SubscriptionResponse, err error) {
+	client := resty.New()
+	defer func() {
+		if closeErr := client.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	req := client.R()
+	req.SetHeader("User-Agent", "clash.meta/v1.19.14")
+
+	r, err := req.Get(subUrl)
+	if err != nil {
+		return
+	}
+
+	res = SubscriptionResponse{
+		StatusCode: r.StatusCode(),
+		Body:       r.String(),
+		Header:     r.Header(),
+	}
+	return
+}
+
+// readLocalSubscription 读取 LocalSubDir 内的本地订阅文件
+// 文件名会作为 Content-Disposition 透传，从而作为订阅名称
+func readLocalSubscription(path string) (res SubscriptionResponse, err error) {
+	path = strings.TrimLeft(path, "/")
+
+	baseDir, err := filepath.Abs(LocalSubDir)
+	if err != nil {
+		return
+	}
+
+	fullPath := filepath.Join(baseDir, filepath.FromSlash(path))
+	rel, err := filepath.Rel(baseDir, fullPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		err = fmt.Errorf("file subscription must be inside %s: %s", LocalSubDir, path)
+		return
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return
+	}
+
+	res = SubscriptionResponse{
+		StatusCode: http.StatusOK,
+		Body:       string(content),
+		Header:     http.Header{},
+	}
+	res.Header.Set("Content-Disposition", fmt.Sprintf(
+		"attachment; filename*=UTF-8''%s", url.PathEscape(filepath.Base(fullPath)),
+	))
+	return
+}
+
+// decodeDataUri 解析 data: URI 订阅
+// 格式: data:[<mediatype>][;base64],<data>
+func decodeDataUri(uri string) (res SubscriptionResponse, err error) {
+	meta, data, found := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !found {
+		err = fmt.Errorf("invalid data uri: missing comma")
+		return
+	}
+
+	mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+
+	var body string
+	if isBase64 {
+		decoded, e := decodeBase64(data)
+		if e != nil {
+			err = fmt.Errorf("invalid data uri: %s", e.Error())
+			return
+		}
+		body = string(decoded)
+	} else {
+		body, err = url.PathUnescape(data)
+		if err != nil {
+			// 未编码的明文直接使用
+			body, err = data, nil
+		}
+	}
+
+	res = SubscriptionResponse{
+		StatusCode: http.StatusOK,
+		Body:       body,
+		Header:     http.Header{},
+	}
+	if mediaType != "" {
+		res.Header.Set("Content-Type", mediaType)
+	}
+	return
+}
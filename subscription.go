@@ -5,9 +5,6 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-
-	"gopkg.in/yaml.v3"
-	"resty.dev/v3"
 )
 
 // SubscriptionMeta 订阅元信息
@@ -20,6 +17,7 @@ type SubscriptionMeta struct {
 	Expire     int64
 	StatusCode int
 	RawBody    string
+	Parser     string // 实际使用的订阅解析器名称
 }
 
 // SubscriptionData 订阅数据容器，包含节点、透传头和订阅信息
@@ -94,48 +92,36 @@ func removeExtension(filename string) string {
 }
 
 // ExtractProxies 从订阅URL提取节点和元信息
+// 订阅URL支持 http(s)://、file: 和 data:
+// 可通过 #parser=xxx 显式指定解析器，否则按 Content-Type 和内容自动选择
 func ExtractProxies(url string, name string) (nodes SubscriptionData, err error) {
 	nodes = SubscriptionData{
 		TransparentHeaders: make(map[string]string),
 		SubInfos:           make([]*SubscriptionMeta, 0, 1),
 	}
 
+	url, hint := splitParserHint(url)
 	subInfo := &SubscriptionMeta{
 		Url:  url,
 		Name: name,
 	}
 
-	L().Info(fmt.Sprintf("Fetching nodes: %s", url))
-
-	client := resty.New()
-	defer func() {
-		if closeErr := client.Close(); closeErr != nil && err == nil {
-			err = closeErr
-		}
-	}()
-
-	req := client.R()
-	req.SetHeader("User-Agent", "clash.meta/v1.19.14")
+	L().Info(fmt.Sprintf("Fetching nodes: %s", subscriptionLogUrl(url)))
 
-	res, err := req.Get(url)
+	res, err := fetchSubscription(url)
 	if err != nil {
 		return
 	}
 
-	subInfo.StatusCode = res.StatusCode()
-	subInfo.RawBody = res.String()
+	subInfo.StatusCode = res.StatusCode
+	subInfo.RawBody = res.Body
 
-	if res.StatusCode() != 200 {
-		err = fmt.Errorf("%d\n%s", res.StatusCode(), res.String())
-		return
-	}
-
-	err = yaml.Unmarshal(res.Bytes(), &nodes)
-	if err != nil {
+	if res.StatusCode != 200 {
+		err = fmt.Errorf("%d\n%s", res.StatusCode, res.Body)
 		return
 	}
 
-	headers := res.Header()
+	headers := res.Header
 
 	// 优先使用 Content-Disposition 中的文件名
 	contentDisposition := headers.Get("Content-Disposition")
@@ -146,6 +132,18 @@ func ExtractProxies(url string, name string) (nodes SubscriptionData, err error)
 		}
 	}
 
+	parser, err := selectParser(hint, headers.Get("Content-Type"), res.Body)
+	if err != nil {
+		return
+	}
+	subInfo.Parser = parser.Name()
+	L().Info(fmt.Sprintf("Parsing %s with parser: %s", subscriptionLogUrl(url), parser.Name()))
+
+	nodes.Proxies, err = parser.Parse(res.Body, subInfo)
+	if err != nil {
+		return
+	}
+
 	for header := range ClashHeaders {
 		headerValue := headers.Get(header)
 		if headerValue != "" {
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// surgeProxyLinePattern Surge / Loon 节点行: 名称 = 类型, 参数...
+	surgeProxyLinePattern = regexp.MustCompile(`^[^=]+=\s*[A-Za-z0-9-]+\s*,`)
+	// quanxProxyLinePattern Quantumult X 节点行: 类型=host:port, 参数...
+	quanxProxyLinePattern = regexp.MustCompile(`^(?i)(shadowsocks|vmess|vless|trojan|http)\s*=\s*[^,]+:\d+\s*,`)
+)
+
+// surgeProxyLines 提取 Surge / Loon / Quantumult X 配置中的节点行
+// 若存在 [Proxy] 或 [server_local] 段则只取该段，否则取全文
+func surgeProxyLines(body string) (lines []string, hasSection bool) {
+	inSection := false
+	all := make([]string, 0)
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section := strings.ToLower(line[1 : len(line)-1])
+			inSection = section == "proxy" || section == "server_local"
+			hasSection = hasSection || inSection
+			continue
+		}
+
+		if inSection {
+			lines = append(lines, line)
+		}
+		all = append(all, line)
+	}
+
+	if !hasSection {
+		lines = all
+	}
+	return
+}
+
+// isProxyLine 判断是否为 Surge / Loon 或 Quantumult X 的节点行
+func isProxyLine(line string) bool {
+	return surgeProxyLinePattern.MatchString(line) || quanxProxyLinePattern.MatchString(line)
+}
+
+// isSurgeProxyList 判断内容是否为 Surge / Loon / Quantumult X 节点列表
+// 完整配置文件中 [Proxy] 段可能包含 DIRECT = direct 等行，因此只要求存在节点行；
+// 纯节点列表则要求每一行都是节点行
+func isSurgeProxyList(body string) bool {
+	lines, hasSection := surgeProxyLines(body)
+	if len(lines) == 0 {
+		return false
+	}
+
+	matched := 0
+	for _, line := range lines {
+		if isProxyLine(line) {
+			matched++
+		}
+	}
+
+	if hasSection {
+		return matched > 0
+	}
+	return matched == len(lines)
+}
+
+// parseSurgeProxyList 将 Surge / Loon / Quantumult X 节点列表转换为 Clash 节点
+// 不支持的类型（direct、reject、wireguard 等）会被跳过
+func parseSurgeProxyList(body string) (proxies []map[string]any, err error) {
+	names := NewSet()
+	proxies = make([]map[string]any, 0)
+
+	lines, _ := surgeProxyLines(body)
+	for _, line := range lines {
+		if !isProxyLine(line) {
+			continue
+		}
+
+		var proxy map[string]any
+		var e error
+		if quanxProxyLinePattern.MatchString(line) {
+			proxy, e = parseQuantumultXLine(line)
+		} else {
+			proxy, e = parseSurgeProxyLine(line)
+		}
+		if e != nil {
+			L().Warn(fmt.Sprintf("Skip proxy line: %s", e.Error()))
+			continue
+		}
+
+		proxy["name"] = uniqueName(names, proxy["name"].(string))
+		proxies = append(proxies, proxy)
+	}
+
+	if len(proxies) == 0 {
+		err = fmt.Errorf("no supported proxy found in proxy list")
+	}
+
+	return
+}
+
+// splitProxyParams 按逗号拆分参数，忽略双引号内的逗号并去除引号
+func splitProxyParams(s string) []string {
+	result := make([]string, 0)
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			result = append(result, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	result = append(result, strings.TrimSpace(current.String()))
+
+	return result
+}
+
+// proxyParams 节点行参数：位置参数与 key=value 参数
+type proxyParams struct {
+	positional []string
+	kv         map[string]string
+}
+
+func newProxyParams(params []string) proxyParams {
+	p := proxyParams{
+		positional: make([]string, 0),
+		kv:         make(map[string]string),
+	}
+	for _, param := range params {
+		if key, value, found := strings.Cut(param, "="); found {
+			p.kv[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), "\"")
+		} else {
+			p.positional = append(p.positional, param)
+		}
+	}
+	return p
+}
+
+// get 按顺序返回第一个存在的 key 的值
+func (p proxyParams) get(keys ...string) string {
+	for _, key := range keys {
+		if v := p.kv[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// pos 返回第 i 个位置参数
+func (p proxyParams) pos(i int) string {
+	if i < len(p.positional) {
+		return p.positional[i]
+	}
+	return ""
+}
+
+// isTrue 判断任一 key 是否为 true
+func (p proxyParams) isTrue(keys ...string) bool {
+	for _, key := range keys {
+		if strings.EqualFold(p.kv[key], "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSurgeProxyLine 解析 Surge / Loon 节点行
+// Surge: 名称 = ss, host, port, encrypt-method=aes-128-gcm, password=xxx
+// Loon:  名称 = Shadowsocks, host, port, aes-128-gcm, "password"
+func parseSurgeProxyLine(line string) (map[string]any, error) {
+	name, value, _ := strings.Cut(line, "=")
+	name = strings.TrimSpace(name)
+
+	parts := splitProxyParams(value)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("invalid proxy line: %s", line)
+	}
+
+	proxyType := strings.ToLower(parts[0])
+	server := parts[1]
+	port, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %s", line)
+	}
+
+	p := newProxyParams(parts[3:])
+	proxy := map[string]any{
+		"name":   name,
+		"server": server,
+		"port":   port,
+	}
+
+	switch proxyType {
+	case "ss", "shadowsocks":
+		proxy["type"] = "ss"
+		proxy["cipher"] = firstNonEmpty(p.get("encrypt-method", "method"), p.pos(0))
+		proxy["password"] = firstNonEmpty(p.get("password"), p.pos(1))
+		proxy["udp"] = p.isTrue("udp-relay", "udp")
+		if obfs := p.get("obfs", "obfs-name"); obfs != "" {
+			proxy["plugin"] = "obfs"
+			proxy["plugin-opts"] = map[string]any{
+				"mode": obfs,
+				"host": p.get("obfs-host"),
+			}
+		}
+	case "ssr", "shadowsocksr":
+		proxy["type"] = "ssr"
+		proxy["cipher"] = firstNonEmpty(p.get("encrypt-method", "method"), p.pos(0))
+		proxy["password"] = firstNonEmpty(p.get("password"), p.pos(1))
+		proxy["protocol"] = p.get("protocol")
+		proxy["obfs"] = p.get("obfs")
+		proxy["udp"] = p.isTrue("udp-relay", "udp")
+		if protocolParam := p.get("protocol-param"); protocolParam != "" {
+			proxy["protocol-param"] = protocolParam
+		}
+		if obfsParam := p.get("obfs-param", "obfs-host"); obfsParam != "" {
+			proxy["obfs-param"] = obfsParam
+		}
+	case "vmess":
+		proxy["type"] = "vmess"
+		proxy["cipher"] = "auto"
+		proxy["alterId"] = 0
+		proxy["udp"] = true
+		if len(p.positional) >= 2 {
+			proxy["cipher"] = p.pos(0)
+			proxy["uuid"] = p.pos(1)
+		} else {
+			proxy["uuid"] = firstNonEmpty(p.get("username", "uuid"), p.pos(0))
+		}
+		if alterId, e := strconv.Atoi(p.get("alterid")); e == nil {
+			proxy["alterId"] = alterId
+		}
+		setSurgeTls(proxy, p, "servername")
+		setSurgeTransport(proxy, p)
+	case "vless":
+		proxy["type"] = "vless"
+		proxy["uuid"] = firstNonEmpty(p.get("username", "uuid"), p.pos(0))
+		proxy["udp"] = true
+		if flow := p.get("flow"); flow != "" {
+			proxy["flow"] = flow
+		}
+		setSurgeTls(proxy, p, "servername")
+		setSurgeTransport(proxy, p)
+		if publicKey := p.get("public-key"); publicKey != "" {
+			proxy["reality-opts"] = map[string]any{
+				"public-key": publicKey,
+				"short-id":   p.get("short-id"),
+			}
+		}
+	case "trojan":
+		proxy["type"] = "trojan"
+		proxy["password"] = firstNonEmpty(p.get("password"), p.pos(0))
+		proxy["udp"] = true
+		setSurgeTls(proxy, p, "sni")
+		setSurgeTransport(proxy, p)
+	case "http", "https":
+		proxy["type"] = "http"
+		setSurgeAuth(proxy, p)
+		if proxyType == "https" || p.isTrue("tls", "over-tls") {
+			proxy["tls"] = true
+		}
+		setSurgeTls(proxy, p, "sni")
+	case "socks5", "socks5-tls":
+		proxy["type"] = "socks5"
+		proxy["udp"] = true
+		setSurgeAuth(proxy, p)
+		if proxyType == "socks5-tls" || p.isTrue("tls", "over-tls") {
+			proxy["tls"] = true
+		}
+		setSurgeTls(proxy, p, "sni")
+	case "hysteria2":
+		proxy["type"] = "hysteria2"
+		proxy["password"] = firstNonEmpty(p.get("password"), p.pos(0))
+		if hopping := p.get("port-hopping"); hopping != "" {
+			proxy["ports"] = strings.ReplaceAll(hopping, ";", ",")
+		}
+		if down := p.get("download-bandwidth"); down != "" {
+			proxy["down"] = parseBandwidth(down)
+		}
+		setSurgeTls(proxy, p, "sni")
+	case "tuic", "tuic-v5":
+		proxy["type"] = "tuic"
+		proxy["udp"] = true
+		if token := p.get("token"); token != "" {
+			proxy["token"] = token
+		} else {
+			proxy["uuid"] = p.get("uuid")
+			proxy["password"] = firstNonEmpty(p.get("password"), p.pos(0))
+		}
+		if alpn := p.get("alpn"); alpn != "" {
+			proxy["alpn"] = strings.Split(alpn, ";")
+		}
+		setSurgeTls(proxy, p, "sni")
+	case "snell":
+		proxy["type"] = "snell"
+		proxy["psk"] = p.get("psk")
+		if version, e := strconv.Atoi(p.get("version")); e == nil {
+			proxy["version"] = version
+		}
+		if obfs := p.get("obfs"); obfs != "" {
+			proxy["obfs-opts"] = map[string]any{
+				"mode": obfs,
+				"host": p.get("obfs-host"),
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy type %s: %s", proxyType, name)
+	}
+
+	return proxy, nil
+}
+
+// setSurgeAuth 设置 http / socks5 的用户名和密码
+func setSurgeAuth(proxy map[string]any, p proxyParams) {
+	if username := firstNonEmpty(p.get("username"), p.pos(0)); username != "" {
+		proxy["username"] = username
+	}
+	if password := firstNonEmpty(p.get("password"), p.pos(1)); password != "" {
+		proxy["password"] = password
+	}
+}
+
+// setSurgeTls 设置 TLS 相关参数，兼容 Surge 与 Loon 的写法
+func setSurgeTls(proxy map[string]any, p proxyParams, sniKey string) {
+	if (proxy["type"] == "vmess" || proxy["type"] == "vless") && p.isTrue("tls", "over-tls") {
+		proxy["tls"] = true
+	}
+	if sni := p.get("sni", "tls-name"); sni != "" {
+		proxy[sniKey] = sni
+	}
+	if p.isTrue("skip-cert-verify") {
+		proxy["skip-cert-verify"] = true
+	}
+}
+
+// setSurgeTransport 设置传输层参数
+// Surge: ws=true, ws-path=/, ws-headers=Host:example.com
+// Loon:  transport=ws, path=/, host=example.com
+func setSurgeTransport(proxy map[string]any, p proxyParams) {
+	network := p.get("transport")
+	if p.isTrue("ws") {
+		network = "ws"
+	}
+
+	host := p.get("host")
+	if headers := p.get("ws-headers"); headers != "" {
+		for _, header := range strings.Split(headers, "|") {
+			key, value, _ := strings.Cut(header, ":")
+			if strings.EqualFold(strings.TrimSpace(key), "host") {
+				host = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	setTransport(proxy, network, "", host, firstNonEmpty(p.get("ws-path", "path"), p.get("servicename")))
+}
+
+// parseQuantumultXLine 解析 Quantumult X 节点行
+// 格式: shadowsocks=host:port, method=aes-128-gcm, password=xxx, obfs=wss, obfs-host=xxx, tag=名称
+func parseQuantumultXLine(line string) (map[string]any, error) {
+	proxyType, value, _ := strings.Cut(line, "=")
+	proxyType = strings.ToLower(strings.TrimSpace(proxyType))
+
+	parts := splitProxyParams(value)
+	server, port, err := splitHostPort(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProxyParams(parts[1:])
+	name := firstNonEmpty(p.get("tag"), fmt.Sprintf("%s:%d", server, port))
+	proxy := map[string]any{
+		"name":   name,
+		"server": server,
+		"port":   port,
+	}
+
+	obfs := p.get("obfs")
+	obfsHost := p.get("obfs-host")
+	obfsUri := p.get("obfs-uri")
+	overTls := p.isTrue("over-tls") || obfs == "wss" || obfs == "over-tls"
+	skipVerify := strings.EqualFold(p.get("tls-verification"), "false")
+
+	switch proxyType {
+	case "shadowsocks":
+		proxy["type"] = "ss"
+		proxy["cipher"] = p.get("method")
+		proxy["password"] = p.get("password")
+		proxy["udp"] = p.isTrue("udp-relay")
+
+		// 带 ssr-protocol 的为 ShadowsocksR 节点
+		if protocol := p.get("ssr-protocol"); protocol != "" {
+			proxy["type"] = "ssr"
+			proxy["protocol"] = protocol
+			proxy["obfs"] = firstNonEmpty(obfs, "plain")
+			if protocolParam := p.get("ssr-protocol-param"); protocolParam != "" {
+				proxy["protocol-param"] = protocolParam
+			}
+			if obfsHost != "" {
+				proxy["obfs-param"] = obfsHost
+			}
+			break
+		}
+
+		switch obfs {
+		case "http", "tls":
+			proxy["plugin"] = "obfs"
+			proxy["plugin-opts"] = map[string]any{
+				"mode": obfs,
+				"host": obfsHost,
+			}
+		case "ws", "wss":
+			pluginOpts := map[string]any{
+				"mode": "websocket",
+				"host": obfsHost,
+				"path": firstNonEmpty(obfsUri, "/"),
+			}
+			if obfs == "wss" {
+				pluginOpts["tls"] = true
+			}
+			proxy["plugin"] = "v2ray-plugin"
+			proxy["plugin-opts"] = pluginOpts
+		}
+	case "vmess", "vless":
+		proxy["type"] = proxyType
+		proxy["uuid"] = p.get("password")
+		proxy["udp"] = true
+		if proxyType == "vmess" {
+			proxy["cipher"] = firstNonEmpty(p.get("method"), "auto")
+			proxy["alterId"] = 0
+		}
+		if overTls {
+			proxy["tls"] = true
+			if obfsHost != "" {
+				proxy["servername"] = obfsHost
+			}
+		}
+		if skipVerify {
+			proxy["skip-cert-verify"] = true
+		}
+		if obfs == "ws" || obfs == "wss" {
+			setTransport(proxy, "ws", "", obfsHost, obfsUri)
+		}
+	case "trojan":
+		proxy["type"] = "trojan"
+		proxy["password"] = p.get("password")
+		proxy["udp"] = true
+		if sni := firstNonEmpty(p.get("tls-host"), obfsHost); sni != "" {
+			proxy["sni"] = sni
+		}
+		if skipVerify {
+			proxy["skip-cert-verify"] = true
+		}
+		if obfs == "wss" || obfs == "ws" {
+			setTransport(proxy, "ws", "", obfsHost, obfsUri)
+		}
+	case "http":
+		proxy["type"] = "http"
+		if username := p.get("username"); username != "" {
+			proxy["username"] = username
+		}
+		if password := p.get("password"); password != "" {
+			proxy["password"] = password
+		}
+		if overTls {
+			proxy["tls"] = true
+		}
+		if skipVerify {
+			proxy["skip-cert-verify"] = true
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy type %s: %s", proxyType, name)
+	}
+
+	return proxy, nil
+}
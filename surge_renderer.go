@@ -0,0 +1,579 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// confDialect Surge / Loon 等 .conf 格式客户端的差异
+type confDialect struct {
+	name       string
+	separator  string
+	ruleTypes  map[string]string // Clash 规则类型 -> 目标规则类型
+	groupTypes Set
+	proxyLine  func(proxy map[string]any, name string, sections *[]confSection) (string, bool)
+}
+
+// confSection .conf 配置中的一个段落
+type confSection struct {
+	name  string
+	lines []string
+}
+
+// confSectionName 解析 [Section] 段落头
+func confSectionName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+		return line[1 : len(line)-1], true
+	}
+	return "", false
+}
+
+// confName 替换节点和策略组名称中会破坏 .conf 语法的字符
+func confName(name string) string {
+	return strings.NewReplacer(",", "，", "=", "＝").Replace(name)
+}
+
+// confParams 按顺序拼接 key=value 参数，空值会被跳过
+type confParams []string
+
+func (p *confParams) add(key string, value any) {
+	switch v := value.(type) {
+	case nil:
+		return
+	case string:
+		if v == "" {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	case int:
+		if v == 0 {
+			return
+		}
+	}
+	*p = append(*p, fmt.Sprintf("%s=%v", key, value))
+}
+
+func (p *confParams) raw(value string) {
+	*p = append(*p, value)
+}
+
+var surgeDialect = &confDialect{
+	name:      "surge",
+	separator: ", ",
+	ruleTypes: map[string]string{
+		"DOMAIN":         "DOMAIN",
+		"DOMAIN-SUFFIX":  "DOMAIN-SUFFIX",
+		"DOMAIN-KEYWORD": "DOMAIN-KEYWORD",
+		"IP-CIDR":        "IP-CIDR",
+		"IP-CIDR6":       "IP-CIDR6",
+		"IP-ASN":         "IP-ASN",
+		"GEOIP":          "GEOIP",
+		"SRC-IP-CIDR":    "SRC-IP",
+		"DST-PORT":       "DEST-PORT",
+		"SRC-PORT":       "SRC-PORT",
+		"IN-PORT":        "IN-PORT",
+		"PROCESS-NAME":   "PROCESS-NAME",
+		"NETWORK":        "PROTOCOL",
+		"MATCH":          "FINAL",
+	},
+	groupTypes: NewSet("select", "url-test", "fallback", "load-balance"),
+	proxyLine:  surgeProxyLine,
+}
+
+var loonDialect = &confDialect{
+	name:      "loon",
+	separator: ",",
+	ruleTypes: map[string]string{
+		"DOMAIN":         "DOMAIN",
+		"DOMAIN-SUFFIX":  "DOMAIN-SUFFIX",
+		"DOMAIN-KEYWORD": "DOMAIN-KEYWORD",
+		"IP-CIDR":        "IP-CIDR",
+		"IP-CIDR6":       "IP-CIDR6",
+		"IP-ASN":         "IP-ASN",
+		"GEOIP":          "GEOIP",
+		"SRC-IP-CIDR":    "SRC-IP",
+		"DST-PORT":       "DEST-PORT",
+		"MATCH":          "FINAL",
+	},
+	groupTypes: NewSet("select", "url-test", "fallback", "load-balance"),
+	proxyLine:  loonProxyLine,
+}
+
+// renderSurge 将 Clash 配置渲染为 Surge 配置
+func renderSurge(config map[string]any, template string) (RenderResult, error) {
+	return renderConf(surgeDialect, config, template)
+}
+
+// renderLoon 将 Clash 配置渲染为 Loon 配置
+func renderLoon(config map[string]any, template string) (RenderResult, error) {
+	return renderConf(loonDialect, config, template)
+}
+
+// renderConf 生成 [Proxy]、[Proxy Group]、[Rule] 段落并替换模板中的同名段落
+// 被丢弃的内容会以注释形式写在配置开头
+func renderConf(dialect *confDialect, config map[string]any, template string) (result RenderResult, err error) {
+	valid := NewSet("DIRECT", "REJECT", "REJECT-DROP")
+	extra := make([]confSection, 0)
+
+	proxySection := confSection{name: "Proxy"}
+	for _, proxy := range configProxies(config) {
+		name := anyToString(proxy["name"])
+		line, ok := dialect.proxyLine(proxy, confName(name), &extra)
+		if !ok {
+			result.drop("proxy", fmt.Sprintf("%s (%s)", name, anyToString(proxy["type"])))
+			continue
+		}
+		valid[name] = true
+		proxySection.lines = append(proxySection.lines, fmt.Sprintf("%s = %s", confName(name), line))
+	}
+
+	groups := configGroups(config)
+	supported := make([]map[string]any, 0, len(groups))
+	for _, group := range groups {
+		if !dialect.groupTypes.Has(anyToString(group["type"])) {
+			result.drop("group", fmt.Sprintf("%s (%s)", anyToString(group["name"]), anyToString(group["type"])))
+			continue
+		}
+		supported = append(supported, group)
+	}
+
+	groupSection := confSection{name: "Proxy Group"}
+	for _, group := range pruneGroups(supported, valid, &result) {
+		groupSection.lines = append(groupSection.lines, confGroupLine(dialect, group))
+	}
+
+	ruleSection := confSection{name: "Rule"}
+	for _, rule := range configRules(config) {
+		line, ok := confRuleLine(dialect, rule, valid)
+		if !ok {
+			result.drop("rule", rule)
+			continue
+		}
+		ruleSection.lines = append(ruleSection.lines, line)
+	}
+
+	sections := append([]confSection{proxySection, groupSection, ruleSection}, extra...)
+	result.Body = mergeConfSections(template, sections, result.Dropped)
+	return
+}
+
+// confGroupLine 生成策略组行
+func confGroupLine(dialect *confDialect, group map[string]any) string {
+	groupType := anyToString(group["type"])
+	parts := []string{groupType}
+	for _, member := range groupMembers(group) {
+		parts = append(parts, confName(member))
+	}
+
+	if groupType != "select" {
+		params := confParams{}
+		params.add("url", firstNonEmpty(anyToString(group["url"]), "http://www.gstatic.com/generate_204"))
+		params.add("interval", firstNonEmpty(anyToString(group["interval"]), "300"))
+		params.add("tolerance", anyToInt(group["tolerance"]))
+		if groupType == "load-balance" && dialect == loonDialect {
+			params.add("algorithm", "pcc")
+		}
+		parts = append(parts, params...)
+	}
+
+	return fmt.Sprintf("%s = %s", confName(anyToString(group["name"])), strings.Join(parts, dialect.separator))
+}
+
+// confRuleLine 转换单条规则，目标策略不存在或规则类型不支持时返回 ok=false
+func confRuleLine(dialect *confDialect, rule string, valid Set) (line string, ok bool) {
+	ruleType, payload, target, options, ok := splitRule(rule)
+	if !ok || !valid.Has(target) {
+		return "", false
+	}
+
+	targetType, ok := dialect.ruleTypes[ruleType]
+	if !ok {
+		return "", false
+	}
+
+	switch ruleType {
+	case "NETWORK":
+		payload = strings.ToUpper(payload)
+	case "GEOIP":
+		// 局域网地址不是国家代码，Surge 以内置的 LAN 规则集表示
+		if code := strings.ToLower(payload); code == "lan" || code == "private" {
+			if dialect != surgeDialect {
+				return "", false
+			}
+			targetType, payload = "RULE-SET", "LAN"
+		}
+	}
+
+	parts := []string{targetType}
+	if ruleType != "MATCH" {
+		parts = append(parts, payload)
+	}
+	parts = append(parts, confName(target))
+	for _, option := range options {
+		if option == "no-resolve" {
+			parts = append(parts, option)
+		}
+	}
+	return strings.Join(parts, ","), true
+}
+
+// mergeConfSections 将生成的段落合并进模板，模板中的同名段落会被替换
+func mergeConfSections(template string, sections []confSection, dropped []DroppedItem) string {
+	replaced := NewSet()
+	for _, section := range sections {
+		replaced[section.name] = true
+	}
+
+	var sb strings.Builder
+	for _, item := range dropped {
+		sb.WriteString("# Dropped " + item.String() + "\n")
+	}
+	if len(dropped) > 0 {
+		sb.WriteString("\n")
+	}
+
+	kept := make([]string, 0)
+	skipping := false
+	for _, line := range strings.Split(template, "\n") {
+		if name, ok := confSectionName(line); ok {
+			skipping = replaced.Has(name)
+		}
+		if !skipping {
+			kept = append(kept, line)
+		}
+	}
+	sb.WriteString(strings.TrimSpace(strings.Join(kept, "\n")) + "\n")
+
+	for _, section := range sections {
+		sb.WriteString("\n[" + section.name + "]\n")
+		for _, line := range section.lines {
+			sb.WriteString(line + "\n")
+		}
+	}
+
+	return strings.TrimLeft(sb.String(), "\n")
+}
+
+// surgeProxyLine 生成 Surge 节点行，wireguard 会额外生成 [WireGuard 名称] 段落
+func surgeProxyLine(proxy map[string]any, name string, sections *[]confSection) (string, bool) {
+	server := anyToString(proxy["server"])
+	port := anyToString(proxy["port"])
+	params := confParams{}
+
+	switch anyToString(proxy["type"]) {
+	case "ss":
+		params.raw("ss")
+		params.raw(server)
+		params.raw(port)
+		params.add("encrypt-method", anyToString(proxy["cipher"]))
+		params.add("password", anyToString(proxy["password"]))
+		switch anyToString(proxy["plugin"]) {
+		case "":
+		case "obfs":
+			pluginOpts, _ := proxy["plugin-opts"].(map[string]any)
+			params.add("obfs", anyToString(pluginOpts["mode"]))
+			params.add("obfs-host", anyToString(pluginOpts["host"]))
+		default:
+			return "", false
+		}
+		params.add("udp-relay", anyToBool(proxy["udp"]))
+	case "vmess":
+		params.raw("vmess")
+		params.raw(server)
+		params.raw(port)
+		params.add("username", anyToString(proxy["uuid"]))
+		params.add("vmess-aead", anyToInt(proxy["alterId"]) == 0)
+		if !setSurgeProxyTransport(&params, proxy) {
+			return "", false
+		}
+		params.add("tls", anyToBool(proxy["tls"]))
+		setSurgeProxyTls(&params, proxy)
+	case "trojan":
+		params.raw("trojan")
+		params.raw(server)
+		params.raw(port)
+		params.add("password", anyToString(proxy["password"]))
+		if !setSurgeProxyTransport(&params, proxy) {
+			return "", false
+		}
+		setSurgeProxyTls(&params, proxy)
+	case "http", "socks5":
+		proxyType := anyToString(proxy["type"])
+		if anyToBool(proxy["tls"]) {
+			proxyType = map[string]string{"http": "https", "socks5": "socks5-tls"}[proxyType]
+		}
+		params.raw(proxyType)
+		params.raw(server)
+		params.raw(port)
+		if username := anyToString(proxy["username"]); username != "" {
+			params.raw(username)
+			params.raw(anyToString(proxy["password"]))
+		}
+		setSurgeProxyTls(&params, proxy)
+	case "hysteria2":
+		if anyToString(proxy["obfs"]) != "" {
+			return "", false
+		}
+		params.raw("hysteria2")
+		params.raw(server)
+		params.raw(port)
+		params.add("password", anyToString(proxy["password"]))
+		params.add("download-bandwidth", parseMbps(proxy["down"]))
+		if ports := anyToString(proxy["ports"]); ports != "" {
+			params.add("port-hopping", fmt.Sprintf("%q", strings.ReplaceAll(ports, ",", ";")))
+		}
+		setSurgeProxyTls(&params, proxy)
+	case "tuic":
+		if anyToString(proxy["token"]) != "" {
+			return "", false
+		}
+		params.raw("tuic-v5")
+		params.raw(server)
+		params.raw(port)
+		params.add("password", anyToString(proxy["password"]))
+		params.add("uuid", anyToString(proxy["uuid"]))
+		params.add("alpn", firstNonEmpty(strings.Join(anyToStrings(proxy["alpn"]), ","), "h3"))
+		setSurgeProxyTls(&params, proxy)
+	case "snell":
+		params.raw("snell")
+		params.raw(server)
+		params.raw(port)
+		params.add("psk", anyToString(proxy["psk"]))
+		params.add("version", anyToInt(proxy["version"]))
+		if obfsOpts, ok := proxy["obfs-opts"].(map[string]any); ok {
+			params.add("obfs", anyToString(obfsOpts["mode"]))
+			params.add("obfs-host", anyToString(obfsOpts["host"]))
+		}
+	case "wireguard":
+		params.raw("wireguard")
+		params.add("section-name", name)
+		*sections = append(*sections, surgeWireGuardSection(proxy, name))
+	default:
+		return "", false
+	}
+
+	return strings.Join(params, ", "), true
+}
+
+// setSurgeProxyTls 设置 sni 和 skip-cert-verify，reality 不受支持
+func setSurgeProxyTls(params *confParams, proxy map[string]any) {
+	params.add("sni", firstNonEmpty(anyToString(proxy["servername"]), anyToString(proxy["sni"])))
+	params.add("skip-cert-verify", anyToBool(proxy["skip-cert-verify"]))
+}
+
+// setSurgeProxyTransport 设置 ws 传输，Surge 仅支持 tcp 和 ws
+func setSurgeProxyTransport(params *confParams, proxy map[string]any) bool {
+	if _, ok := proxy["reality-opts"]; ok {
+		return false
+	}
+
+	switch anyToString(proxy["network"]) {
+	case "", "tcp":
+		return true
+	case "ws":
+		wsOpts, _ := proxy["ws-opts"].(map[string]any)
+		params.add("ws", true)
+		params.add("ws-path", anyToString(wsOpts["path"]))
+		if headers, ok := wsOpts["headers"].(map[string]any); ok {
+			params.add("ws-headers", confHeaders(headers))
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// surgeWireGuardSection 生成 Surge 的 [WireGuard 名称] 段落
+func surgeWireGuardSection(proxy map[string]any, name string) confSection {
+	section := confSection{name: "WireGuard " + name}
+	section.lines = append(section.lines, "private-key = "+anyToString(proxy["private-key"]))
+	if ip := anyToString(proxy["ip"]); ip != "" {
+		section.lines = append(section.lines, "self-ip = "+ip)
+	}
+	if ipv6 := anyToString(proxy["ipv6"]); ipv6 != "" {
+		section.lines = append(section.lines, "self-ip-v6 = "+ipv6)
+	}
+	if mtu := anyToInt(proxy["mtu"]); mtu > 0 {
+		section.lines = append(section.lines, fmt.Sprintf("mtu = %d", mtu))
+	}
+
+	peer := confParams{}
+	peer.add("public-key", anyToString(proxy["public-key"]))
+	peer.add("allowed-ips", fmt.Sprintf("%q", firstNonEmpty(strings.Join(anyToStrings(proxy["allowed-ips"]), ", "), "0.0.0.0/0, ::/0")))
+	peer.add("endpoint", fmt.Sprintf("%s:%d", anyToString(proxy["server"]), anyToInt(proxy["port"])))
+	peer.add("preshared-key", anyToString(proxy["pre-shared-key"]))
+	if reserved := anyToStrings(proxy["reserved"]); len(reserved) == 3 {
+		peer.add("client-id", strings.Join(reserved, "/"))
+	}
+	section.lines = append(section.lines, fmt.Sprintf("peer = (%s)", strings.Join(peer, ", ")))
+
+	return section
+}
+
+// loonProxyLine 生成 Loon 节点行
+func loonProxyLine(proxy map[string]any, _ string, _ *[]confSection) (string, bool) {
+	server := anyToString(proxy["server"])
+	port := anyToString(proxy["port"])
+	params := confParams{}
+
+	switch anyToString(proxy["type"]) {
+	case "ss":
+		params.raw("Shadowsocks")
+		params.raw(server)
+		params.raw(port)
+		params.raw(anyToString(proxy["cipher"]))
+		params.raw(fmt.Sprintf("%q", anyToString(proxy["password"])))
+		switch anyToString(proxy["plugin"]) {
+		case "":
+		case "obfs":
+			pluginOpts, _ := proxy["plugin-opts"].(map[string]any)
+			params.add("obfs-name", anyToString(pluginOpts["mode"]))
+			params.add("obfs-host", anyToString(pluginOpts["host"]))
+		default:
+			return "", false
+		}
+		params.add("udp", anyToBool(proxy["udp"]))
+	case "ssr":
+		params.raw("ShadowsocksR")
+		params.raw(server)
+		params.raw(port)
+		params.raw(anyToString(proxy["cipher"]))
+		params.raw(fmt.Sprintf("%q", anyToString(proxy["password"])))
+		params.add("protocol", anyToString(proxy["protocol"]))
+		params.add("protocol-param", anyToString(proxy["protocol-param"]))
+		params.add("obfs", anyToString(proxy["obfs"]))
+		params.add("obfs-param", anyToString(proxy["obfs-param"]))
+	case "vmess":
+		params.raw("vmess")
+		params.raw(server)
+		params.raw(port)
+		params.raw(firstNonEmpty(anyToString(proxy["cipher"]), "auto"))
+		params.raw(fmt.Sprintf("%q", anyToString(proxy["uuid"])))
+		if !setLoonProxyTransport(&params, proxy) {
+			return "", false
+		}
+		params.add("over-tls", anyToBool(proxy["tls"]))
+		setLoonProxyTls(&params, proxy)
+		params.add("alterId", anyToInt(proxy["alterId"]))
+	case "vless":
+		params.raw("VLESS")
+		params.raw(server)
+		params.raw(port)
+		params.raw(fmt.Sprintf("%q", anyToString(proxy["uuid"])))
+		if !setLoonProxyTransport(&params, proxy) {
+			return "", false
+		}
+		params.add("over-tls", anyToBool(proxy["tls"]))
+		setLoonProxyTls(&params, proxy)
+		params.add("flow", anyToString(proxy["flow"]))
+		if realityOpts, ok := proxy["reality-opts"].(map[string]any); ok {
+			params.add("public-key", fmt.Sprintf("%q", anyToString(realityOpts["public-key"])))
+			params.add("short-id", anyToString(realityOpts["short-id"]))
+		}
+	case "trojan":
+		params.raw("trojan")
+		params.raw(server)
+		params.raw(port)
+		params.raw(fmt.Sprintf("%q", anyToString(proxy["password"])))
+		if !setLoonProxyTransport(&params, proxy) {
+			return "", false
+		}
+		setLoonProxyTls(&params, proxy)
+	case "http", "socks5":
+		proxyType := anyToString(proxy["type"])
+		if proxyType == "http" && anyToBool(proxy["tls"]) {
+			proxyType = "https"
+		}
+		params.raw(proxyType)
+		params.raw(server)
+		params.raw(port)
+		if username := anyToString(proxy["username"]); username != "" {
+			params.raw(username)
+			params.raw(fmt.Sprintf("%q", anyToString(proxy["password"])))
+		}
+		if proxyType == "socks5" {
+			params.add("over-tls", anyToBool(proxy["tls"]))
+		}
+		setLoonProxyTls(&params, proxy)
+	case "hysteria2":
+		params.raw("Hysteria2")
+		params.raw(server)
+		params.raw(port)
+		params.raw(fmt.Sprintf("%q", anyToString(proxy["password"])))
+		setLoonProxyTls(&params, proxy)
+		params.add("download-bandwidth", parseMbps(proxy["down"]))
+		if anyToString(proxy["obfs"]) == "salamander" {
+			params.add("salamander-password", anyToString(proxy["obfs-password"]))
+		}
+	case "wireguard":
+		params.raw("WireGuard")
+		params.add("interface-ip", anyToString(proxy["ip"]))
+		params.add("interface-ipv6", anyToString(proxy["ipv6"]))
+		params.add("private-key", fmt.Sprintf("%q", anyToString(proxy["private-key"])))
+		params.add("mtu", anyToInt(proxy["mtu"]))
+
+		peer := confParams{}
+		peer.add("public-key", fmt.Sprintf("%q", anyToString(proxy["public-key"])))
+		peer.add("allowed-ips", fmt.Sprintf("%q", firstNonEmpty(strings.Join(anyToStrings(proxy["allowed-ips"]), ","), "0.0.0.0/0,::/0")))
+		peer.add("endpoint", fmt.Sprintf("%s:%d", anyToString(proxy["server"]), anyToInt(proxy["port"])))
+		if psk := anyToString(proxy["pre-shared-key"]); psk != "" {
+			peer.add("preshared-key", fmt.Sprintf("%q", psk))
+		}
+		if reserved := anyToStrings(proxy["reserved"]); len(reserved) == 3 {
+			peer.add("reserved", "["+strings.Join(reserved, ",")+"]")
+		}
+		params.add("peers", "[{"+strings.Join(peer, ",")+"}]")
+	default:
+		return "", false
+	}
+
+	return strings.Join(params, ","), true
+}
+
+// setLoonProxyTls 设置 sni 和 skip-cert-verify
+func setLoonProxyTls(params *confParams, proxy map[string]any) {
+	params.add("sni", firstNonEmpty(anyToString(proxy["servername"]), anyToString(proxy["sni"])))
+	params.add("skip-cert-verify", anyToBool(proxy["skip-cert-verify"]))
+}
+
+// setLoonProxyTransport 设置 transport，Loon 支持 tcp、ws 和 http
+func setLoonProxyTransport(params *confParams, proxy map[string]any) bool {
+	switch anyToString(proxy["network"]) {
+	case "", "tcp":
+		params.add("transport", "tcp")
+	case "ws":
+		wsOpts, _ := proxy["ws-opts"].(map[string]any)
+		headers, _ := wsOpts["headers"].(map[string]any)
+		params.add("transport", "ws")
+		params.add("path", anyToString(wsOpts["path"]))
+		params.add("host", anyToString(headers["Host"]))
+	case "http":
+		httpOpts, _ := proxy["http-opts"].(map[string]any)
+		headers, _ := httpOpts["headers"].(map[string]any)
+		params.add("transport", "http")
+		if paths := anyToStrings(httpOpts["path"]); len(paths) > 0 {
+			params.add("path", paths[0])
+		}
+		if host := anyToStrings(headers["Host"]); len(host) > 0 {
+			params.add("host", host[0])
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// confHeaders 将 ws headers 转为 Host:a|User-Agent:b 格式
+func confHeaders(headers map[string]any) string {
+	parts := make([]string, 0, len(headers))
+	for k, v := range headers {
+		parts = append(parts, k+":"+anyToString(v))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
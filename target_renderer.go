@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LogicalRuleTypes 逻辑规则类型，其 payload 内含逗号
+var LogicalRuleTypes = NewSet("AND", "OR", "NOT", "SUB-RULE")
+
+// DroppedItem 目标客户端不支持而被丢弃的内容
+type DroppedItem struct {
+	Kind string // proxy、group、rule 等
+	Item string
+}
+
+func (d DroppedItem) String() string {
+	return fmt.Sprintf("%s: %s", d.Kind, d.Item)
+}
+
+// RenderResult 输出目标的渲染结果
+type RenderResult struct {
+	Body    string
+	Dropped []DroppedItem
+}
+
+// drop 记录被丢弃的内容
+func (r *RenderResult) drop(kind string, item string) {
+	r.Dropped = append(r.Dropped, DroppedItem{Kind: kind, Item: item})
+}
+
+// DroppedCount 统计某一类被丢弃内容的数量
+func (r *RenderResult) DroppedCount(kind string) (count int) {
+	for _, item := range r.Dropped {
+		if item.Kind == kind {
+			count++
+		}
+	}
+	return
+}
+
+// ConfigRenderer 将最终的 Clash 配置渲染为其他客户端格式
+type ConfigRenderer struct {
+	ContentType     string
+	DefaultTemplate string // config 目录下的默认基础模板，为空表示不需要
+	ProxiesOnly     bool   // 仅输出合并后的节点，跳过模板和脚本
+	Render          func(config map[string]any, template string) (RenderResult, error)
+}
+
+// uriRenderer 分享链接列表输出，v2ray 与 uri 为同一目标
+var uriRenderer = &ConfigRenderer{
+	ContentType: "text/plain; charset=utf-8",
+	ProxiesOnly: true,
+	Render:      renderUriList,
+}
+
+// ConfigRenderers 支持的输出目标，clash 为默认输出不在此列
+var ConfigRenderers = map[string]*ConfigRenderer{
+	"singbox": {
+		ContentType:     "application/json; charset=utf-8",
+		DefaultTemplate: "template.singbox.json",
+		Render:          renderSingBox,
+	},
+	"surge": {
+		ContentType:     "text/plain; charset=utf-8",
+		DefaultTemplate: "template.surge.conf",
+		Render:          renderSurge,
+	},
+	"loon": {
+		ContentType:     "text/plain; charset=utf-8",
+		DefaultTemplate: "template.loon.conf",
+		Render:          renderLoon,
+	},
+	"quanx": {
+		ContentType:     "text/plain; charset=utf-8",
+		DefaultTemplate: "template.quanx.conf",
+		Render:          renderQuantumultX,
+	},
+	"v2ray": uriRenderer,
+	"uri":   uriRenderer,
+}
+
+// renderTarget 解析最终的 Clash 配置并交给输出目标渲染
+// templateUrl 为空时不使用基础模板
+func renderTarget(renderer *ConfigRenderer, clashConfig string, templateUrl string) (result RenderResult, err error) {
+	var config map[string]any
+	err = yaml.Unmarshal([]byte(clashConfig), &config)
+	if err != nil {
+		return
+	}
+
+	template := ""
+	if templateUrl != "" {
+		template, err = FetchString(templateUrl)
+		if err != nil {
+			return
+		}
+	}
+
+	return renderer.Render(config, template)
+}
+
+// splitRule 拆分已添加 tag 的规则
+// TYPE,PAYLOAD,TARGET[,OPTIONS...] 或 MATCH,TARGET；逻辑规则返回 ok=false
+func splitRule(rule string) (ruleType, payload, target string, options []string, ok bool) {
+	parts := strings.Split(rule, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	ruleType = strings.ToUpper(parts[0])
+	if LogicalRuleTypes.Has(ruleType) {
+		return
+	}
+
+	if ruleType == "MATCH" || ruleType == "FINAL" {
+		if len(parts) < 2 {
+			return
+		}
+		ruleType = "MATCH"
+		target = parts[1]
+		ok = true
+		return
+	}
+
+	if len(parts) < 3 {
+		return
+	}
+
+	if RegexRuleTypes.Has(ruleType) {
+		_, body, _ := strings.Cut(rule, ",")
+		var rest []string
+		payload, rest = splitRegexPayload(strings.Split(body, ","), true)
+		if len(rest) == 0 {
+			return
+		}
+		target, options = rest[0], rest[1:]
+		ok = true
+		return
+	}
+
+	payload, target, options = parts[1], parts[2], parts[3:]
+	ok = true
+	return
+}
+
+// parseMbps 将 "100 Mbps" 形式的带宽转为数字
+func parseMbps(v any) int {
+	fields := strings.Fields(anyToString(v))
+	if len(fields) == 0 {
+		return 0
+	}
+	return anyToInt(fields[0])
+}
+
+// configProxies 读取配置中的 proxies
+func configProxies(config map[string]any) []map[string]any {
+	items, _ := config["proxies"].([]any)
+	result := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		if proxy, ok := item.(map[string]any); ok {
+			result = append(result, proxy)
+		}
+	}
+	return result
+}
+
+// configGroups 读取配置中的 proxy-groups
+func configGroups(config map[string]any) []map[string]any {
+	items, _ := config["proxy-groups"].([]any)
+	result := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		if group, ok := item.(map[string]any); ok {
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+// configRules 读取配置中的 rules
+func configRules(config map[string]any) []string {
+	items, _ := config["rules"].([]any)
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if rule, ok := item.(string); ok {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// groupMembers 读取策略组的成员
+func groupMembers(group map[string]any) []string {
+	return anyToStrings(group["proxies"])
+}
+
+// pruneGroups 移除策略组中无效的成员，并反复移除因此变空（且没有 use）的策略组
+// valid 为节点及内置策略名称，返回保留下来的策略组名称集合
+func pruneGroups(groups []map[string]any, valid Set, result *RenderResult) (kept []map[string]any) {
+	kept = groups
+	for _, group := range kept {
+		valid[anyToString(group["name"])] = true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		next := make([]map[string]any, 0, len(kept))
+		for _, group := range kept {
+			members := make([]string, 0)
+			for _, member := range groupMembers(group) {
+				if valid.Has(member) {
+					members = append(members, member)
+				}
+			}
+			if _, ok := group["proxies"]; ok {
+				group["proxies"] = members
+			}
+
+			if len(members) == 0 && len(anyToStrings(group["use"])) == 0 {
+				name := anyToString(group["name"])
+				delete(valid, name)
+				result.drop("group", name)
+				changed = true
+				continue
+			}
+			next = append(next, group)
+		}
+		kept = next
+	}
+
+	return
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// renderUriList 将节点序列化为分享链接并整体 base64 编码，是 parseUriList 的逆过程
+// 不支持的节点类型会被丢弃
+func renderUriList(config map[string]any, _ string) (result RenderResult, err error) {
+	lines := make([]string, 0)
+	for _, proxy := range configProxies(config) {
+		uri, e := encodeProxyUri(proxy)
+		if e != nil {
+			result.drop("proxy", fmt.Sprintf("%s (%s)", anyToString(proxy["name"]), e.Error()))
+			continue
+		}
+		lines = append(lines, uri)
+	}
+
+	result.Body = base64.StdEncoding.EncodeToString([]byte(strings.Join(lines, "\n")))
+	return
+}
+
+// encodeProxyUri 根据节点类型生成分享链接
+func encodeProxyUri(proxy map[string]any) (string, error) {
+	proxyType := anyToString(proxy["type"])
+	switch proxyType {
+	case "ss":
+		return encodeShadowsocksUri(proxy)
+	case "ssr":
+		return encodeShadowsocksRUri(proxy), nil
+	case "vmess":
+		return encodeVmessUri(proxy)
+	case "vless":
+		return encodeVlessUri(proxy)
+	case "trojan":
+		return encodeTrojanUri(proxy)
+	case "hysteria2":
+		return encodeHysteria2Uri(proxy), nil
+	case "tuic":
+		return encodeTuicUri(proxy)
+	default:
+		return "", fmt.Errorf("unsupported proxy type: %s", proxyType)
+	}
+}
+
+// proxyHostPort 返回 host:port，IPv6 地址会加上方括号
+func proxyHostPort(proxy map[string]any) string {
+	return net.JoinHostPort(anyToString(proxy["server"]), anyToString(proxy["port"]))
+}
+
+// proxyFragment 返回编码后的 #名称
+func proxyFragment(proxy map[string]any) string {
+	return "#" + url.PathEscape(anyToString(proxy["name"]))
+}
+
+// encodeShadowsocksUri 生成 SIP002 格式的 ss:// 链接
+// AEAD-2022 加密的 userinfo 为百分号编码的明文，其余为 base64
+func encodeShadowsocksUri(proxy map[string]any) (string, error) {
+	cipher, password := anyToString(proxy["cipher"]), anyToString(proxy["password"])
+	userInfo := base64.RawURLEncoding.EncodeToString([]byte(cipher + ":" + password))
+	if strings.HasPrefix(cipher, "2022-") {
+		userInfo = url.UserPassword(cipher, password).String()
+	}
+
+	query := ""
+	pluginOpts, _ := proxy["plugin-opts"].(map[string]any)
+	switch plugin := anyToString(proxy["plugin"]); plugin {
+	case "":
+	case "obfs":
+		query = "?plugin=" + url.QueryEscape(fmt.Sprintf(
+			"obfs-local;obfs=%s;obfs-host=%s", anyToString(pluginOpts["mode"]), anyToString(pluginOpts["host"]),
+		))
+	case "v2ray-plugin":
+		_, opts := singBoxPlugin(proxy)
+		query = "?plugin=" + url.QueryEscape("v2ray-plugin;"+opts)
+	default:
+		return "", fmt.Errorf("unsupported ss plugin: %s", plugin)
+	}
+
+	return "ss://" + userInfo + "@" + proxyHostPort(proxy) + "/" + query + proxyFragment(proxy), nil
+}
+
+// encodeShadowsocksRUri 生成 ssr:// 链接
+func encodeShadowsocksRUri(proxy map[string]any) string {
+	b64 := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	body := strings.Join([]string{
+		anyToString(proxy["server"]),
+		anyToString(proxy["port"]),
+		anyToString(proxy["protocol"]),
+		anyToString(proxy["cipher"]),
+		anyToString(proxy["obfs"]),
+		b64(anyToString(proxy["password"])),
+	}, ":")
+
+	query := url.Values{}
+	query.Set("obfsparam", b64(anyToString(proxy["obfs-param"])))
+	query.Set("protoparam", b64(anyToString(proxy["protocol-param"])))
+	query.Set("remarks", b64(anyToString(proxy["name"])))
+
+	return "ssr://" + b64(body+"/?"+query.Encode())
+}
+
+// encodeVmessUri 生成 v2rayN 格式的 vmess:// 链接
+func encodeVmessUri(proxy map[string]any) (string, error) {
+	network, headerType, host, path, err := proxyTransport(proxy)
+	if err != nil {
+		return "", err
+	}
+
+	v := map[string]any{
+		"v":    "2",
+		"ps":   anyToString(proxy["name"]),
+		"add":  anyToString(proxy["server"]),
+		"port": anyToString(proxy["port"]),
+		"id":   anyToString(proxy["uuid"]),
+		"aid":  anyToString(proxy["alterId"]),
+		"scy":  firstNonEmpty(anyToString(proxy["cipher"]), "auto"),
+		"net":  network,
+		"type": firstNonEmpty(headerType, "none"),
+		"host": host,
+		"path": path,
+		"tls":  "",
+	}
+	if anyToBool(proxy["tls"]) {
+		v["tls"] = "tls"
+		v["sni"] = anyToString(proxy["servername"])
+		v["alpn"] = strings.Join(anyToStrings(proxy["alpn"]), ",")
+		v["fp"] = anyToString(proxy["client-fingerprint"])
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// encodeVlessUri 生成 vless:// 链接
+func encodeVlessUri(proxy map[string]any) (string, error) {
+	query := url.Values{}
+	query.Set("encryption", "none")
+	if err := setTransportQuery(query, proxy); err != nil {
+		return "", err
+	}
+	if flow := anyToString(proxy["flow"]); flow != "" {
+		query.Set("flow", flow)
+	}
+
+	if realityOpts, ok := proxy["reality-opts"].(map[string]any); ok {
+		query.Set("security", "reality")
+		query.Set("pbk", anyToString(realityOpts["public-key"]))
+		if sid := anyToString(realityOpts["short-id"]); sid != "" {
+			query.Set("sid", sid)
+		}
+		setTlsQuery(query, proxy, "servername", "allowInsecure")
+	} else if anyToBool(proxy["tls"]) {
+		query.Set("security", "tls")
+		setTlsQuery(query, proxy, "servername", "allowInsecure")
+	} else {
+		query.Set("security", "none")
+	}
+
+	return "vless://" + url.User(anyToString(proxy["uuid"])).String() + "@" + proxyHostPort(proxy) +
+		"?" + query.Encode() + proxyFragment(proxy), nil
+}
+
+// encodeTrojanUri 生成 trojan:// 链接
+func encodeTrojanUri(proxy map[string]any) (string, error) {
+	query := url.Values{}
+	if err := setTransportQuery(query, proxy); err != nil {
+		return "", err
+	}
+	setTlsQuery(query, proxy, "sni", "allowInsecure")
+
+	return "trojan://" + url.User(anyToString(proxy["password"])).String() + "@" + proxyHostPort(proxy) +
+		"?" + query.Encode() + proxyFragment(proxy), nil
+}
+
+// encodeHysteria2Uri 生成 hysteria2:// 链接
+func encodeHysteria2Uri(proxy map[string]any) string {
+	query := url.Values{}
+	if obfs := anyToString(proxy["obfs"]); obfs != "" {
+		query.Set("obfs", obfs)
+		query.Set("obfs-password", anyToString(proxy["obfs-password"]))
+	}
+	if ports := anyToString(proxy["ports"]); ports != "" {
+		query.Set("mport", ports)
+	}
+	if pin := anyToString(proxy["fingerprint"]); pin != "" {
+		query.Set("pinSHA256", pin)
+	}
+	setTlsQuery(query, proxy, "sni", "insecure")
+
+	return "hysteria2://" + url.User(anyToString(proxy["password"])).String() + "@" + proxyHostPort(proxy) +
+		"/?" + query.Encode() + proxyFragment(proxy)
+}
+
+// encodeTuicUri 生成 TUIC v5 的 tuic:// 链接
+func encodeTuicUri(proxy map[string]any) (string, error) {
+	if anyToString(proxy["token"]) != "" {
+		return "", fmt.Errorf("tuic v4 has no share link format")
+	}
+
+	query := url.Values{}
+	if cc := anyToString(proxy["congestion-controller"]); cc != "" {
+		query.Set("congestion_control", cc)
+	}
+	if mode := anyToString(proxy["udp-relay-mode"]); mode != "" {
+		query.Set("udp_relay_mode", mode)
+	}
+	if anyToBool(proxy["disable-sni"]) {
+		query.Set("disable_sni", "1")
+	}
+	if anyToBool(proxy["reduce-rtt"]) {
+		query.Set("reduce_rtt", "1")
+	}
+	setTlsQuery(query, proxy, "sni", "allow_insecure")
+
+	userInfo := url.UserPassword(anyToString(proxy["uuid"]), anyToString(proxy["password"])).String()
+	return "tuic://" + userInfo + "@" + proxyHostPort(proxy) + "?" + query.Encode() + proxyFragment(proxy), nil
+}
+
+// setTlsQuery 写入 sni、alpn、fp 和跳过证书验证参数，insecureKey 因协议而异
+func setTlsQuery(query url.Values, proxy map[string]any, sniKey string, insecureKey string) {
+	if sni := anyToString(proxy[sniKey]); sni != "" {
+		query.Set("sni", sni)
+	}
+	if alpn := anyToStrings(proxy["alpn"]); len(alpn) > 0 {
+		query.Set("alpn", strings.Join(alpn, ","))
+	}
+	if fingerprint := anyToString(proxy["client-fingerprint"]); fingerprint != "" {
+		query.Set("fp", fingerprint)
+	}
+	if anyToBool(proxy["skip-cert-verify"]) {
+		query.Set(insecureKey, "1")
+	}
+}
+
+// setTransportQuery 写入 type、headerType、host、path / serviceName
+func setTransportQuery(query url.Values, proxy map[string]any) error {
+	network, headerType, host, path, err := proxyTransport(proxy)
+	if err != nil {
+		return err
+	}
+
+	query.Set("type", network)
+	if headerType != "" {
+		query.Set("headerType", headerType)
+	}
+	if host != "" {
+		query.Set("host", host)
+	}
+	if path != "" {
+		if network == "grpc" {
+			query.Set("serviceName", path)
+		} else {
+			query.Set("path", path)
+		}
+	}
+	return nil
+}
+
+// proxyTransport 读取节点的传输层参数，是 setTransport 的逆过程
+// grpc 的 path 为 service name，http 传输以 tcp + headerType=http 表示
+func proxyTransport(proxy map[string]any) (network, headerType, host, path string, err error) {
+	switch network = firstNonEmpty(anyToString(proxy["network"]), "tcp"); network {
+	case "tcp":
+	case "ws":
+		wsOpts, _ := proxy["ws-opts"].(map[string]any)
+		headers, _ := wsOpts["headers"].(map[string]any)
+		host = anyToString(headers["Host"])
+		path = anyToString(wsOpts["path"])
+		if anyToBool(wsOpts["v2ray-http-upgrade"]) {
+			network = "httpupgrade"
+		}
+	case "grpc":
+		grpcOpts, _ := proxy["grpc-opts"].(map[string]any)
+		path = anyToString(grpcOpts["grpc-service-name"])
+	case "h2":
+		h2Opts, _ := proxy["h2-opts"].(map[string]any)
+		host = strings.Join(anyToStrings(h2Opts["host"]), ",")
+		path = anyToString(h2Opts["path"])
+	case "http":
+		httpOpts, _ := proxy["http-opts"].(map[string]any)
+		headers, _ := httpOpts["headers"].(map[string]any)
+		network, headerType = "tcp", "http"
+		host = strings.Join(anyToStrings(headers["Host"]), ",")
+		path = strings.Join(anyToStrings(httpOpts["path"]), ",")
+	default:
+		err = fmt.Errorf("unsupported network: %s", network)
+	}
+	return
+}
@@ -41,6 +41,24 @@ var (
 	}()
 
 	Token = os.Getenv("ACCESS_TOKEN")
+
+	// GeodataDir geosite.dat、geoip.dat 或 mmdb 所在的目录，用于展开 GEOSITE / GEOIP 规则
+	GeodataDir = func() string {
+		path, exist := os.LookupEnv("GEODATA_DIR")
+		if !exist {
+			path = "./data"
+		}
+		return path
+	}()
+
+	// LocalSubDir file: 订阅允许读取的目录
+	LocalSubDir = func() string {
+		path, exist := os.LookupEnv("LOCAL_SUB_DIR")
+		if !exist {
+			path = "./data/subs"
+		}
+		return path
+	}()
 )
 
 // FileExists 检查文件是否存在
@@ -127,3 +145,21 @@ func FetchString(url string) (string, error) {
 
 	return res.String(), client.Close()
 }
+
+// FetchBytes 下载原始内容，不去除首尾空白，用于 .mrs 等二进制文件，HTTP 错误状态码视为失败
+func FetchBytes(url string) ([]byte, error) {
+	L().Info(fmt.Sprintf("Fetching %s", url))
+
+	client := resty.New().SetRetryCount(3)
+	res, err := client.R().Get(url)
+
+	if err != nil {
+		return nil, err
+	}
+	if res.IsError() {
+		_ = client.Close()
+		return nil, fmt.Errorf("fetch %s: %s", url, res.Status())
+	}
+
+	return res.Bytes(), client.Close()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// isWireGuardConf 判断内容是否为 WireGuard 配置文件
+func isWireGuardConf(body string) bool {
+	return strings.Contains(body, "[Interface]") && strings.Contains(body, "[Peer]")
+}
+
+// parseWireGuardConf 解析标准 WireGuard 配置文件
+// 每个 [Peer] 生成一个节点，共享 [Interface] 中的密钥与地址
+func parseWireGuardConf(body string, name string) (proxies []map[string]any, err error) {
+	iface := make(map[string]string)
+	peers := make([]map[string]string, 0, 1)
+
+	var section map[string]string
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		switch strings.ToLower(line) {
+		case "[interface]":
+			section = iface
+			continue
+		case "[peer]":
+			section = make(map[string]string)
+			peers = append(peers, section)
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found || section == nil {
+			continue
+		}
+		section[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	if iface["privatekey"] == "" {
+		err = fmt.Errorf("wireguard config missing PrivateKey")
+		return
+	}
+
+	names := NewSet()
+	proxies = make([]map[string]any, 0, len(peers))
+	for _, peer := range peers {
+		server, port, e := splitHostPort(peer["endpoint"])
+		if e != nil {
+			err = fmt.Errorf("wireguard peer endpoint: %s", e.Error())
+			return
+		}
+
+		proxy := map[string]any{
+			"name":        uniqueName(names, name),
+			"type":        "wireguard",
+			"server":      server,
+			"port":        port,
+			"private-key": iface["privatekey"],
+			"public-key":  peer["publickey"],
+			"udp":         true,
+		}
+
+		setWireGuardAddress(proxy, iface["address"])
+
+		if psk := peer["presharedkey"]; psk != "" {
+			proxy["pre-shared-key"] = psk
+		}
+		if allowedIps := splitList(peer["allowedips"]); len(allowedIps) > 0 {
+			proxy["allowed-ips"] = allowedIps
+		}
+		if mtu, e := strconv.Atoi(iface["mtu"]); e == nil {
+			proxy["mtu"] = mtu
+		}
+		if dns := splitList(iface["dns"]); len(dns) > 0 {
+			proxy["dns"] = dns
+			proxy["remote-dns-resolve"] = true
+		}
+		if reserved := peer["reserved"]; reserved != "" {
+			proxy["reserved"] = parseWireGuardReserved(reserved)
+		}
+
+		proxies = append(proxies, proxy)
+	}
+
+	if len(proxies) == 0 {
+		err = fmt.Errorf("wireguard config has no [Peer]")
+	}
+
+	return
+}
+
+// setWireGuardAddress 将 Address 拆分为 Clash 的 ip / ipv6 字段
+func setWireGuardAddress(proxy map[string]any, address string) {
+	for _, addr := range splitList(address) {
+		ip, _, _ := strings.Cut(addr, "/")
+		if strings.Contains(ip, ":") {
+			proxy["ipv6"] = ip
+		} else {
+			proxy["ip"] = ip
+		}
+	}
+}
+
+// parseWireGuardReserved 解析 reserved 字段
+// 支持 "1,2,3" 形式和 base64 字符串形式
+func parseWireGuardReserved(reserved string) any {
+	parts := splitList(reserved)
+	if len(parts) != 3 {
+		return reserved
+	}
+
+	result := make([]int, 0, 3)
+	for _, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return reserved
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// splitList 按逗号拆分并去除空白项
+func splitList(s string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}